@@ -8,6 +8,7 @@ type CancelQuery func() error
 
 type QueryInfo struct {
 	Id         string      `json:"id"`
-	QueryStats stmtStats   `json:"query_stats"`
+	QueryStats QueryStats  `json:"query_stats"`
+	Warnings   []Warning   `json:"warnings"`
 	Cancel     CancelQuery `json:"cancel"`
 }
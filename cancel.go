@@ -0,0 +1,156 @@
+package trino
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+var (
+	// DefaultCancelQueryRetries is the number of times the request to cancel
+	// a query is retried before giving up.
+	DefaultCancelQueryRetries = 3
+
+	// cancelQueryRetryDelay is the delay before the first retry, doubled
+	// for every following one.
+	cancelQueryRetryDelay = 100 * time.Millisecond
+)
+
+// queryCanceller cancels a running query on the server. It is safe for
+// concurrent use, so that the query can be cancelled from a goroutine
+// watching the query's context while its rows are being read.
+type queryCanceller struct {
+	conn    *Conn
+	server  string
+	headers http.Header
+	queryID string
+
+	mu       sync.Mutex
+	nextURI  string
+	finished bool // the query completed, failed or was cancelled
+	done     chan struct{}
+}
+
+func newQueryCanceller(conn *Conn, server string, headers http.Header, queryID, nextURI string) *queryCanceller {
+	return &queryCanceller{
+		conn:    conn,
+		server:  server,
+		headers: headers,
+		queryID: queryID,
+		nextURI: nextURI,
+		done:    make(chan struct{}),
+	}
+}
+
+// update records the latest nextUri of the query. An empty nextUri means
+// the query is over and there's nothing left to cancel.
+func (c *queryCanceller) update(nextURI string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.finished {
+		return
+	}
+	c.nextURI = nextURI
+	if nextURI == "" {
+		c.finished = true
+		close(c.done)
+	}
+}
+
+// watch cancels the query in the background as soon as ctx is done, unless
+// the query is over by then.
+func (c *queryCanceller) watch(ctx context.Context) {
+	if ctx.Done() == nil {
+		return
+	}
+	go func() {
+		select {
+		case <-ctx.Done():
+			c.cancel()
+		case <-c.done:
+		}
+	}()
+}
+
+// cancel cancels the query, unless it is over or already being cancelled.
+// The nextUri is used first, falling back to killing the query by ID. Each
+// attempt is retried up to DefaultCancelQueryRetries times, all within
+// DefaultCancelQueryTimeout.
+func (c *queryCanceller) cancel() error {
+	c.mu.Lock()
+	if c.finished {
+		c.mu.Unlock()
+		return nil
+	}
+	c.finished = true
+	close(c.done)
+	nextURI := c.nextURI
+	c.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultCancelQueryTimeout)
+	defer cancel()
+	delay := cancelQueryRetryDelay
+	var err error
+	for attempt := 0; attempt <= DefaultCancelQueryRetries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return err
+			case <-time.After(delay):
+			}
+			delay *= 2
+		}
+		if attempt == 0 && nextURI != "" {
+			err = c.delete(ctx, nextURI, false)
+		} else {
+			err = c.delete(ctx, c.server+"/v1/query/"+c.queryID, true)
+		}
+		if err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// stop cancels a query whose remaining results are not needed. The
+// partialCancelUri, when known, is used first to tell Trino to stop
+// producing output.
+func (c *queryCanceller) stop(partialCancelURI string) error {
+	if partialCancelURI != "" {
+		ctx, cancel := context.WithTimeout(context.Background(), DefaultCancelQueryTimeout)
+		c.delete(ctx, partialCancelURI, true)
+		cancel()
+	}
+	return c.cancel()
+}
+
+// delete sends a DELETE request to uri. When killing the query by ID,
+// notFoundOK is set as the query no longer exists once it is over.
+func (c *queryCanceller) delete(ctx context.Context, uri string, notFoundOK bool) error {
+	req, err := c.conn.newRequest("DELETE", uri, nil, c.headers)
+	if err != nil {
+		return err
+	}
+	resp, err := c.conn.do(ctx, &Request{Request: req.WithContext(ctx), Phase: PhaseCancel, QueryID: c.queryID})
+	if err != nil {
+		if _, ok := err.(*ErrQueryFailed); ok {
+			return err
+		}
+		return &ErrQueryFailed{Reason: err}
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusNoContent:
+		return nil
+	case http.StatusNotFound, http.StatusGone:
+		if notFoundOK {
+			return nil
+		}
+	}
+	return &ErrQueryFailed{
+		StatusCode: resp.StatusCode,
+		Reason:     fmt.Errorf("cancel query error: http status is %s", resp.Status),
+	}
+}
@@ -0,0 +1,300 @@
+package trino
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// Client runs queries on Trino without going through database/sql, giving
+// access to their whole lifecycle: query IDs, statistics, warnings, update
+// counts, column type signatures and pages of results. It is safe for
+// concurrent use.
+type Client struct {
+	conn *Conn
+}
+
+// NewClient returns a client for the DSN.
+func NewClient(dsn string) (*Client, error) {
+	conn, err := newConn(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{conn: conn}, nil
+}
+
+// Client returns a client using the DSN and the options of the connector.
+func (c *Connector) Client() (*Client, error) {
+	conn, err := c.Connect(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	return &Client{conn: conn.(*Conn)}, nil
+}
+
+// Close cancels the queries of the client that are still running.
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// QueryOptions are the options of a query submitted with Client.Submit.
+// They are added to the options set on its context with WithUser,
+// WithCatalogSchema and the like.
+type QueryOptions struct {
+	User              string
+	Catalog           string
+	Schema            string
+	SessionProperties map[string]string
+	Listener          QueryListener
+	Timeout           time.Duration // of the query, including the reading of its results
+	// Args are the values of the ? parameters of the query, which is then
+	// run as a prepared statement.
+	Args []interface{}
+}
+
+func (o *QueryOptions) apply(ctx context.Context) context.Context {
+	if o.User != "" {
+		ctx = WithUser(ctx, o.User)
+	}
+	if o.Catalog != "" || o.Schema != "" {
+		opts := queryOptionsFromContext(ctx)
+		catalog, schema := o.Catalog, o.Schema
+		if catalog == "" {
+			catalog = opts.catalog
+		}
+		if schema == "" {
+			schema = opts.schema
+		}
+		ctx = WithCatalogSchema(ctx, catalog, schema)
+	}
+	if len(o.SessionProperties) > 0 {
+		ctx = WithSessionProperties(ctx, o.SessionProperties)
+	}
+	if o.Listener != nil {
+		ctx = WithQueryListener(ctx, o.Listener)
+	}
+	if o.Timeout > 0 {
+		ctx = WithQueryTimeout(ctx, o.Timeout)
+	}
+	return ctx
+}
+
+// Submit submits a query, and returns once Trino accepted it and sent its
+// first page of results, or its columns. The results must be read to the
+// end, waited for with Query.Wait, or cancelled with Query.Cancel. opts may
+// be nil.
+func (c *Client) Submit(ctx context.Context, query string, opts *QueryOptions) (*Query, error) {
+	st := &driverStmt{conn: c.conn, query: query}
+	var args []driver.NamedValue
+	if opts != nil {
+		ctx = opts.apply(ctx)
+		for i, arg := range opts.Args {
+			nv := driver.NamedValue{Ordinal: i + 1, Value: arg}
+			if err := st.CheckNamedValue(&nv); err != nil {
+				return nil, err
+			}
+			args = append(args, nv)
+		}
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	rows, err := st.submit(ctx, args)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	return &Query{rows: rows, cancel: cancel}, nil
+}
+
+// Query is a query submitted with Client.Submit.
+type Query struct {
+	rows   *driverRows
+	cancel context.CancelFunc
+
+	mu      sync.Mutex // held while reading the results
+	started bool       // the first page was returned
+	err     error      // that ended the query, io.EOF once all pages were read
+}
+
+// Column is a column of the results of a query.
+type Column struct {
+	Name          string
+	Type          string // e.g. varchar(10)
+	TypeSignature TypeSignature
+}
+
+// Page is a page of results, as sent by Trino.
+type Page struct {
+	// Rows are the values of the rows of the page, of the Go types the
+	// driver converts Trino types to, or nil for NULL.
+	Rows [][]interface{}
+	// Stats are the statistics of the query when the page was sent.
+	Stats QueryStats
+}
+
+// ID returns the ID of the query.
+func (q *Query) ID() string {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.rows.queryID
+}
+
+// Columns returns the columns of the results, or nil for a query without
+// results, such as an INSERT.
+func (q *Query) Columns() []Column {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.rows.colinfo == nil {
+		return nil
+	}
+	columns := make([]Column, len(q.rows.colinfo))
+	for i, c := range q.rows.colinfo {
+		columns[i] = Column{Name: c.Name, Type: c.Type, TypeSignature: c.TypeSignature}
+	}
+	return columns
+}
+
+// Stats returns the latest statistics of the query.
+func (q *Query) Stats() QueryStats {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.rows.stats
+}
+
+// Warnings returns the warnings raised by the query so far.
+func (q *Query) Warnings() []Warning {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.rows.Warnings()
+}
+
+// UpdateType returns the type of statement of a query that modifies data
+// or metadata, e.g. INSERT or CREATE TABLE, and the number of rows it
+// updated.
+func (q *Query) UpdateType() (string, int64) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.rows.updateType, q.rows.updateCount
+}
+
+// NextPage returns the next page of results with rows, or io.EOF once all
+// of them were returned. Pages without rows are skipped.
+func (q *Query) NextPage() (*Page, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.err != nil {
+		return nil, q.err
+	}
+	if q.started || q.rows.rowcount == 0 {
+		if q.rows.nextURI == "" {
+			return nil, q.finish(io.EOF)
+		}
+		if err := q.rows.fetch(true); err != nil {
+			return nil, q.finish(err)
+		}
+	}
+	q.started = true
+	return q.page(), nil
+}
+
+// page copies the rows of the current page of the driverRows, whose values
+// are overwritten by the next one.
+func (q *Query) page() *Page {
+	qr := q.rows
+	values := make([]interface{}, len(qr.data))
+	for i, v := range qr.data {
+		values[i] = v
+	}
+	page := &Page{Rows: make([][]interface{}, qr.rowcount), Stats: qr.stats}
+	n := len(qr.coltype)
+	for i := range page.Rows {
+		page.Rows[i] = values[i*n : (i+1)*n : (i+1)*n]
+	}
+	return page
+}
+
+// finish releases the resources of the query once it ended with err.
+func (q *Query) finish(err error) error {
+	if q.rows.ctx.Err() == context.Canceled && err != io.EOF {
+		err = ErrQueryCancelled
+	}
+	q.err = err
+	q.rows.err = err
+	q.rows.Close()
+	q.cancel()
+	return err
+}
+
+// Wait waits for the query to finish, discarding the results not read yet,
+// and returns its error if it failed.
+func (q *Query) Wait() error {
+	for {
+		if _, err := q.NextPage(); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+// Cancel cancels the query, unless it finished already. It can be called
+// while the results are being read, which then fails with
+// ErrQueryCancelled.
+func (q *Query) Cancel() error {
+	err := q.rows.canceller.cancel()
+	q.cancel()
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.err == nil {
+		q.finish(ErrQueryCancelled)
+	}
+	return err
+}
+
+// Do sends a request to the coordinator with the headers, authentication,
+// TLS settings and interceptors of the client, for the endpoints the client
+// doesn't cover, such as the ones of the trinoadmin package. A request with
+// a relative URL, e.g. /v1/node, is sent to the reachable coordinators in
+// the order of the DSN, failing over to the next one when a coordinator
+// can't be connected to and the body of the request can be sent again. The
+// response is returned whatever its status, and its body must be closed.
+func (c *Client) Do(ctx context.Context, req *Request) (*Response, error) {
+	for k, v := range c.conn.httpHeaders {
+		if _, ok := req.Header[k]; !ok {
+			req.Header[k] = append([]string(nil), v...)
+		}
+	}
+	if req.URL.IsAbs() {
+		req.Request = req.WithContext(ctx)
+		return c.conn.do(ctx, req)
+	}
+	ref := req.URL
+	var err error
+	for i, host := range c.conn.hosts.order(0) {
+		if i > 0 && !rewindBody(req.Request) {
+			break
+		}
+		base, perr := url.Parse(host)
+		if perr != nil {
+			return nil, fmt.Errorf("trino: %v", perr)
+		}
+		req.URL = base.ResolveReference(ref)
+		req.Host = req.URL.Host
+		req.Request = req.WithContext(ctx)
+		var resp *Response
+		resp, err = c.conn.do(ctx, req)
+		if err == nil {
+			c.conn.hosts.markUp(host)
+			return resp, nil
+		}
+		if !isDialError(err) || ctx.Err() != nil {
+			return nil, err
+		}
+		c.conn.hosts.markDown(host)
+	}
+	return nil, err
+}
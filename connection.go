@@ -8,35 +8,63 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
-	"math"
 	"net/http"
 	"net/url"
 	"strconv"
-	"time"
-
-	"gopkg.in/jcmturner/gokrb5.v6/client"
-	"gopkg.in/jcmturner/gokrb5.v6/config"
-	"gopkg.in/jcmturner/gokrb5.v6/keytab"
+	"strings"
+	"sync"
+	"sync/atomic"
 )
 
 // Conn is a Trino connection. implements driver.Conn & driver.ConnPrepareContext
 type Conn struct {
-	baseURL         string
 	auth            *url.Userinfo
 	httpClient      http.Client
 	httpHeaders     http.Header
-	kerberosClient  client.Client
+	kerberosClient  *kerberosClient
 	kerberosEnabled bool
+
+	kerberosRemoteServiceName       string
+	kerberosServicePrincipalPattern string
+	kerberosUseCanonicalHostname    bool
+
+	listener         QueryListener
+	tracer           Tracer
+	metrics          Metrics
+	name             string // of the Connector, for the labels of metrics
+	warningsAsErrors []string
+	pingQuery        string
+	prefetchPages    int
+	encodings        []string
+	hosts            *hostPool
+	uriRewriter      URIRewriter
+	rewriteURIs      bool
+	spoolingWorkers  int
+	chain            RoundTripFunc // sends the requests through the interceptors
+	intercepted      bool          // whether the chain has interceptors of the Connector
+	logger           Logger
+	debug            debugLevel
+
+	mu       sync.Mutex
+	liveRows map[*driverRows]struct{}
+	closed   bool
+	bad      int32 // set atomically when auth expired or the coordinator is unreachable
 }
 
 var (
 	_ driver.Conn               = &Conn{}
 	_ driver.ConnPrepareContext = &Conn{}
+	_ driver.SessionResetter    = &Conn{}
+	_ driver.Validator          = &Conn{}
 )
 
 func newConn(dsn string) (*Conn, error) {
 	serverURL, err := url.Parse(dsn)
 	if err != nil {
+		if ue, ok := err.(*url.Error); ok {
+			// the DSN may hold a password
+			err = ue.Err
+		}
 		return nil, fmt.Errorf("trino: malformed dsn: %v", err)
 	}
 
@@ -44,25 +72,18 @@ func newConn(dsn string) (*Conn, error) {
 
 	kerberosEnabled, _ := strconv.ParseBool(query.Get(KerberosEnabledConfig))
 
-	var kerberosClient client.Client
+	var kerberosClient *kerberosClient
 
 	if kerberosEnabled {
-		kt, err := keytab.Load(query.Get(_kerberosKeytabPathConfig))
-		if err != nil {
-			return nil, fmt.Errorf("trino: Error loading Keytab: %v", err)
-		}
-
-		kerberosClient = client.NewClientWithKeytab(query.Get(_kerberosPrincipalConfig), query.Get(_kerberosRealmConfig), kt)
-		conf, err := config.Load(query.Get(_kerberosConfigPathConfig))
+		kerberosClient, err = getKerberosClient(kerberosCredentials{
+			principal:  query.Get(_kerberosPrincipalConfig),
+			realm:      query.Get(_kerberosRealmConfig),
+			keytabPath: query.Get(_kerberosKeytabPathConfig),
+			ccachePath: query.Get(_kerberosCredentialCachePathConfig),
+			configPath: query.Get(_kerberosConfigPathConfig),
+		})
 		if err != nil {
-			return nil, fmt.Errorf("trino: Error loading krb config: %v", err)
-		}
-
-		kerberosClient.WithConfig(conf)
-
-		loginErr := kerberosClient.Login()
-		if loginErr != nil {
-			return nil, fmt.Errorf("trino: Error login to KDC: %v", loginErr)
+			return nil, err
 		}
 	}
 
@@ -90,11 +111,51 @@ func newConn(dsn string) (*Conn, error) {
 	}
 
 	c := &Conn{
-		baseURL:         serverURL.Scheme + "://" + serverURL.Host,
 		httpClient:      *httpClient,
 		httpHeaders:     make(http.Header),
+		liveRows:        make(map[*driverRows]struct{}),
 		kerberosClient:  kerberosClient,
 		kerberosEnabled: kerberosEnabled,
+
+		kerberosRemoteServiceName:       DefaultKerberosRemoteServiceName,
+		kerberosServicePrincipalPattern: DefaultKerberosServicePrincipalPattern,
+	}
+
+	if name := query.Get(_kerberosRemoteServiceNameConfig); name != "" {
+		c.kerberosRemoteServiceName = name
+	}
+	if pattern := query.Get(_kerberosServicePrincipalPatternConfig); pattern != "" {
+		c.kerberosServicePrincipalPattern = pattern
+	}
+	c.kerberosUseCanonicalHostname, _ = strconv.ParseBool(query.Get(_kerberosUseCanonicalHostnameConfig))
+	c.warningsAsErrors = splitList(query.Get("warnings_as_errors"))
+	c.pingQuery = query.Get("ping_query")
+	c.rewriteURIs, _ = strconv.ParseBool(query.Get("rewrite_uris"))
+	if c.debug, err = parseDebugLevel(query.Get("debug")); err != nil {
+		return nil, err
+	}
+	if c.debug != debugOff {
+		c.logger = stdLogger{}
+	}
+	c.hosts, err = getHostPool(serverURL, query.Get("hosts"), query.Get("host_selection"))
+	if err != nil {
+		return nil, err
+	}
+	c.encodings = splitList(query.Get("encoding"))
+	if err := validateEncodings(c.encodings); err != nil {
+		return nil, err
+	}
+	if workers := query.Get("spooling_workers"); workers != "" {
+		c.spoolingWorkers, err = strconv.Atoi(workers)
+		if err != nil || c.spoolingWorkers < 1 {
+			return nil, fmt.Errorf("trino: invalid spooling_workers: %q", workers)
+		}
+	}
+	if pages := query.Get("prefetch_pages"); pages != "" {
+		c.prefetchPages, err = strconv.Atoi(pages)
+		if err != nil || c.prefetchPages < 0 {
+			return nil, fmt.Errorf("trino: invalid prefetch_pages: %q", pages)
+		}
 	}
 
 	var user string
@@ -118,6 +179,13 @@ func newConn(dsn string) (*Conn, error) {
 		}
 	}
 
+	for param, key := range dsnClientHeaders {
+		if err := setClientHeader(c.httpHeaders, key, query.Get(param)); err != nil {
+			return nil, err
+		}
+	}
+
+	c.chain = c.buildChain(nil)
 	return c, nil
 }
 
@@ -136,77 +204,100 @@ func (c *Conn) PrepareContext(ctx context.Context, query string) (driver.Stmt, e
 	return &driverStmt{conn: c, query: query}, nil
 }
 
-// Close implements the driver.Conn interface.
+// Close implements the driver.Conn interface. Queries still running on the
+// connection are cancelled.
 func (c *Conn) Close() error {
+	c.mu.Lock()
+	c.closed = true
+	live := make([]*driverRows, 0, len(c.liveRows))
+	for qr := range c.liveRows {
+		live = append(live, qr)
+	}
+	c.liveRows = make(map[*driverRows]struct{})
+	c.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, qr := range live {
+		wg.Add(1)
+		go func(qr *driverRows) {
+			defer wg.Done()
+			qr.canceller.cancel()
+		}(qr)
+	}
+	wg.Wait()
 	return nil
 }
 
 // ResetSession implements driver.SessionResetter
 func (c *Conn) ResetSession(ctx context.Context) error {
+	if !c.IsValid() {
+		return driver.ErrBadConn
+	}
 	return nil
 }
 
+// IsValid implements driver.Validator. A connection is invalid once it is
+// closed, or after its authentication expired or the coordinator could not
+// be reached, so that database/sql drops it from the pool.
+func (c *Conn) IsValid() bool {
+	c.mu.Lock()
+	closed := c.closed
+	c.mu.Unlock()
+	return !closed && atomic.LoadInt32(&c.bad) == 0
+}
+
+// trackRows registers the rows of a running query, so that the query is
+// cancelled when the connection is closed.
+func (c *Conn) trackRows(qr *driverRows) {
+	c.mu.Lock()
+	c.liveRows[qr] = struct{}{}
+	c.mu.Unlock()
+}
+
+// untrackRows removes the rows of a query that is over.
+func (c *Conn) untrackRows(qr *driverRows) {
+	c.mu.Lock()
+	delete(c.liveRows, qr)
+	c.mu.Unlock()
+}
+
 func (c *Conn) newRequest(method, url string, body io.Reader, hs http.Header) (*http.Request, error) {
 	req, err := http.NewRequest(method, url, body)
 	if err != nil {
 		return nil, fmt.Errorf("trino: %v", err)
 	}
 
-	if c.kerberosEnabled {
-		err = c.kerberosClient.SetSPNEGOHeader(req, "presto/"+req.URL.Hostname())
-		if err != nil {
-			return nil, fmt.Errorf("error setting client SPNEGO header: %v", err)
-		}
-	}
-
 	for k, v := range c.httpHeaders {
 		req.Header[k] = v
 	}
 	for k, v := range hs {
 		req.Header[k] = v
 	}
-
-	if c.auth != nil {
-		pass, _ := c.auth.Password()
-		req.SetBasicAuth(c.auth.Username(), pass)
-	}
 	return req, nil
 }
 
-func (c *Conn) roundTrip(ctx context.Context, req *http.Request) (*http.Response, error) {
-	delay := 100 * time.Millisecond
-	const maxDelayBetweenRequests = float64(15 * time.Second)
-	timer := time.NewTimer(0)
-	defer timer.Stop()
-	for {
-		select {
-		case <-ctx.Done():
-			return nil, ctx.Err()
-		case <-timer.C:
-			timeout := DefaultQueryTimeout
-			if deadline, ok := ctx.Deadline(); ok {
-				timeout = deadline.Sub(time.Now())
-			}
-			client := c.httpClient
-			client.Timeout = timeout
-			resp, err := client.Do(req)
-			if err != nil {
-				return nil, &ErrQueryFailed{Reason: err}
-			}
-			switch resp.StatusCode {
-			case http.StatusOK:
-				return resp, nil
-			case http.StatusServiceUnavailable:
-				resp.Body.Close()
-				timer.Reset(delay)
-				delay = time.Duration(math.Min(
-					float64(delay)*math.Phi,
-					maxDelayBetweenRequests,
-				))
-				continue
-			default:
-				return nil, newErrQueryFailedFromResponse(resp)
-			}
-		}
+// kerberosSPN returns the service principal of the coordinator at host.
+func (c *Conn) kerberosSPN(host string) string {
+	return kerberosServicePrincipal(
+		c.kerberosServicePrincipalPattern,
+		c.kerberosRemoteServiceName,
+		host,
+		c.kerberosUseCanonicalHostname,
+	)
+}
+
+// renewKerberosAuth logs in to the KDC again and replaces the SPNEGO header
+// of req after the coordinator rejected the ticket. It reports whether req
+// can be retried.
+func (c *Conn) renewKerberosAuth(req *http.Request, resp *http.Response) bool {
+	if !c.kerberosEnabled || !strings.HasPrefix(resp.Header.Get("WWW-Authenticate"), "Negotiate") {
+		return false
+	}
+	if !rewindBody(req) {
+		return false
+	}
+	if err := c.kerberosClient.relogin(); err != nil {
+		return false
 	}
+	return c.kerberosClient.setSPNEGOHeader(req, c.kerberosSPN(req.URL.Hostname())) == nil
 }
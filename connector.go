@@ -0,0 +1,92 @@
+package trino
+
+import (
+	"context"
+	"database/sql/driver"
+)
+
+// Connector implements driver.Connector. It allows configuring the driver
+// with values that can't be expressed in a DSN, and is used with
+// sql.OpenDB:
+//
+//	connector, err := trino.NewConnector(dsn)
+//	if err != nil {
+//		...
+//	}
+//	connector.QueryListener = listener
+//	db := sql.OpenDB(connector)
+//
+// The exported fields must not be modified once the connector is in use.
+type Connector struct {
+	// QueryListener is notified of the lifecycle of every query run on
+	// connections of this connector (optional).
+	QueryListener QueryListener
+
+	// URIRewriter rewrites the URIs advertised by the coordinator, taking
+	// precedence over the rewrite_uris DSN parameter (optional).
+	URIRewriter URIRewriter
+
+	// Tracer traces the queries, see Tracer (optional).
+	Tracer Tracer
+
+	// Metrics receives the measurements of the queries, see Metrics
+	// (optional).
+	Metrics Metrics
+
+	// Interceptors wrap the requests to the coordinator, see Interceptor
+	// (optional).
+	Interceptors []Interceptor
+
+	// Logger receives the debug logs of the requests to the coordinator, at
+	// the level of the debug DSN parameter, DebugRequests by default. The
+	// standard log package is used when the debug parameter is set without
+	// a Logger (optional).
+	Logger Logger
+
+	// Name identifies the connector in the labels of metrics (optional).
+	Name string
+
+	dsn string
+}
+
+var _ driver.Connector = &Connector{}
+
+// NewConnector returns a connector for the DSN, which is validated by
+// opening a first connection.
+func NewConnector(dsn string) (*Connector, error) {
+	c := &Connector{dsn: dsn}
+	if _, err := newConn(dsn); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Connect implements the driver.Connector interface.
+func (c *Connector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := newConn(c.dsn)
+	if err != nil {
+		return nil, err
+	}
+	conn.listener = c.QueryListener
+	conn.tracer = c.Tracer
+	conn.metrics = c.Metrics
+	conn.name = c.Name
+	if c.URIRewriter != nil {
+		conn.uriRewriter = c.URIRewriter
+	}
+	if c.Logger != nil {
+		conn.logger = c.Logger
+		if conn.debug == debugOff {
+			conn.debug = debugRequests
+		}
+	}
+	if len(c.Interceptors) > 0 {
+		conn.chain = conn.buildChain(c.Interceptors)
+	}
+	return conn, nil
+}
+
+// Driver implements the driver.Connector interface.
+func (c *Connector) Driver() driver.Driver {
+	return &sqldriver{}
+}
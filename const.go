@@ -10,21 +10,61 @@ const (
 	_xTrinoSchemaHeader  = "X-Trino-Schema"
 	_xTrinoSessionHeader = "X-Trino-Session"
 
+	_xTrinoClientTagsHeader       = "X-Trino-Client-Tags"
+	_xTrinoClientInfoHeader       = "X-Trino-Client-Info"
+	_xTrinoTraceTokenHeader       = "X-Trino-Trace-Token"
+	_xTrinoRoleHeader             = "X-Trino-Role"
+	_xTrinoExtraCredentialHeader  = "X-Trino-Extra-Credential"
+	_xTrinoTimeZoneHeader         = "X-Trino-Time-Zone"
+	_xTrinoLanguageHeader         = "X-Trino-Language"
+	_xTrinoPathHeader             = "X-Trino-Path"
+	_xTrinoResourceEstimateHeader = "X-Trino-Resource-Estimate"
+
+	_xTrinoQueryDataEncodingHeader = "X-Trino-Query-Data-Encoding"
+
 	_xPrestoUserHeader    = "X-Presto-User"
 	_xPrestoSourceHeader  = "X-Presto-Source"
 	_xPrestoCatalogHeader = "X-Presto-Catalog"
 	_xPrestoSchemaHeader  = "X-Presto-Schema"
 	_xPrestoSessionHeader = "X-Presto-Session"
 
+	_xPrestoClientTagsHeader       = "X-Presto-Client-Tags"
+	_xPrestoClientInfoHeader       = "X-Presto-Client-Info"
+	_xPrestoTraceTokenHeader       = "X-Presto-Trace-Token"
+	_xPrestoRoleHeader             = "X-Presto-Role"
+	_xPrestoExtraCredentialHeader  = "X-Presto-Extra-Credential"
+	_xPrestoTimeZoneHeader         = "X-Presto-Time-Zone"
+	_xPrestoLanguageHeader         = "X-Presto-Language"
+	_xPrestoPathHeader             = "X-Presto-Path"
+	_xPrestoResourceEstimateHeader = "X-Presto-Resource-Estimate"
+
 	UserHeader     = "User"
 	CallbackHeader = "Callback"
 
+	// Named arguments overriding the connection's client headers for a
+	// single query. Map-valued headers take a comma-separated list of
+	// key=value pairs, client tags a comma-separated list.
+	ClientTagsHeader        = "ClientTags"
+	ClientInfoHeader        = "ClientInfo"
+	TraceTokenHeader        = "TraceToken"
+	RolesHeader             = "Roles"
+	ExtraCredentialsHeader  = "ExtraCredentials"
+	TimeZoneHeader          = "TimeZone"
+	LanguageHeader          = "Language"
+	PathHeader              = "Path"
+	ResourceEstimatesHeader = "ResourceEstimates"
+
 	KerberosEnabledConfig     = "KerberosEnabled"
 	_kerberosKeytabPathConfig = "KerberosKeytabPath"
 	_kerberosPrincipalConfig  = "KerberosPrincipal"
 	_kerberosRealmConfig      = "KerberosRealm"
 	_kerberosConfigPathConfig = "KerberosConfigPath"
 	SSLCertPathConfig         = "SSLCertPath"
+
+	_kerberosCredentialCachePathConfig     = "KerberosCredentialCachePath"
+	_kerberosRemoteServiceNameConfig       = "KerberosRemoteServiceName"
+	_kerberosServicePrincipalPatternConfig = "KerberosServicePrincipalPattern"
+	_kerberosUseCanonicalHostnameConfig    = "KerberosUseCanonicalHostname"
 )
 
 var (
@@ -35,6 +75,19 @@ var (
 			"catalog": _xTrinoCatalogHeader,
 			"schema":  _xTrinoSchemaHeader,
 			"session": _xTrinoSessionHeader,
+
+			"clientTags":       _xTrinoClientTagsHeader,
+			"clientInfo":       _xTrinoClientInfoHeader,
+			"traceToken":       _xTrinoTraceTokenHeader,
+			"role":             _xTrinoRoleHeader,
+			"extraCredential":  _xTrinoExtraCredentialHeader,
+			"timeZone":         _xTrinoTimeZoneHeader,
+			"language":         _xTrinoLanguageHeader,
+			"path":             _xTrinoPathHeader,
+			"resourceEstimate": _xTrinoResourceEstimateHeader,
+
+			// Presto doesn't support the spooling protocol
+			"queryDataEncoding": _xTrinoQueryDataEncodingHeader,
 		},
 		_prestoVersion: {
 			"user":    _xPrestoUserHeader,
@@ -42,6 +95,16 @@ var (
 			"catalog": _xPrestoCatalogHeader,
 			"schema":  _xPrestoSchemaHeader,
 			"session": _xPrestoSessionHeader,
+
+			"clientTags":       _xPrestoClientTagsHeader,
+			"clientInfo":       _xPrestoClientInfoHeader,
+			"traceToken":       _xPrestoTraceTokenHeader,
+			"role":             _xPrestoRoleHeader,
+			"extraCredential":  _xPrestoExtraCredentialHeader,
+			"timeZone":         _xPrestoTimeZoneHeader,
+			"language":         _xPrestoLanguageHeader,
+			"path":             _xPrestoPathHeader,
+			"resourceEstimate": _xPrestoResourceEstimateHeader,
 		},
 	}
 )
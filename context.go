@@ -0,0 +1,134 @@
+package trino
+
+import (
+	"context"
+	"time"
+)
+
+type queryOptionsKey struct{}
+
+// queryOptions are the per-query options carried by a context.
+type queryOptions struct {
+	user              string
+	sessionProperties map[string]string
+	catalog           string
+	schema            string
+	callback          QueryCallBack
+	listener          QueryListener
+	warningsAsErrors  []string
+	maxRows           int64
+	prefetchPages     int
+	prefetchSet       bool
+	timeout           time.Duration
+	detached          bool // submitted with Client.SubmitDetached
+}
+
+// QueryCallBackFunc is an adapter to allow the use of ordinary functions as
+// a QueryCallBack.
+type QueryCallBackFunc func(QueryInfo)
+
+// OnUpdated calls f(info).
+func (f QueryCallBackFunc) OnUpdated(info QueryInfo) {
+	f(info)
+}
+
+// queryOptionsFromContext returns a copy of the options set on ctx.
+func queryOptionsFromContext(ctx context.Context) queryOptions {
+	opts, _ := ctx.Value(queryOptionsKey{}).(queryOptions)
+	return opts
+}
+
+func withQueryOptions(ctx context.Context, set func(*queryOptions)) context.Context {
+	opts := queryOptionsFromContext(ctx)
+	set(&opts)
+	return context.WithValue(ctx, queryOptionsKey{}, opts)
+}
+
+// WithUser returns a context that runs queries as user, regardless of the
+// user the connection authenticated with.
+func WithUser(ctx context.Context, user string) context.Context {
+	return withQueryOptions(ctx, func(o *queryOptions) {
+		o.user = user
+	})
+}
+
+// WithSessionProperties returns a context that runs queries with the given
+// session properties, in addition to those of the connection.
+func WithSessionProperties(ctx context.Context, props map[string]string) context.Context {
+	return withQueryOptions(ctx, func(o *queryOptions) {
+		merged := make(map[string]string, len(o.sessionProperties)+len(props))
+		for k, v := range o.sessionProperties {
+			merged[k] = v
+		}
+		for k, v := range props {
+			merged[k] = v
+		}
+		o.sessionProperties = merged
+	})
+}
+
+// WithCatalogSchema returns a context that runs queries in the given catalog
+// and schema instead of those of the connection. Empty values keep the
+// connection's setting.
+func WithCatalogSchema(ctx context.Context, catalog, schema string) context.Context {
+	return withQueryOptions(ctx, func(o *queryOptions) {
+		o.catalog = catalog
+		o.schema = schema
+	})
+}
+
+// WithProgress returns a context that calls fn every time the state of a
+// query started with it is updated.
+func WithProgress(ctx context.Context, fn func(QueryInfo)) context.Context {
+	return withQueryOptions(ctx, func(o *queryOptions) {
+		o.callback = nil
+		if fn != nil {
+			o.callback = QueryCallBackFunc(fn)
+		}
+	})
+}
+
+// WithQueryListener returns a context that notifies l of the lifecycle of
+// queries started with it, in addition to the listener of the Connector.
+func WithQueryListener(ctx context.Context, l QueryListener) context.Context {
+	return withQueryOptions(ctx, func(o *queryOptions) {
+		o.listener = l
+	})
+}
+
+// WithWarningsAsErrors returns a context that fails queries started with it
+// with an *ErrQueryWarning when they raise a warning with one of the given
+// names, such as DEPRECATED_FUNCTION, in addition to those set in the DSN.
+func WithWarningsAsErrors(ctx context.Context, names ...string) context.Context {
+	return withQueryOptions(ctx, func(o *queryOptions) {
+		o.warningsAsErrors = append(append([]string(nil), o.warningsAsErrors...), names...)
+	})
+}
+
+// WithMaxRows returns a context that stops the iteration over the results
+// of queries started with it after n rows, and stops the query on the
+// cluster. Iteration ends as if all the results had been read; whether rows
+// were left out is reported by TruncationProvider.
+func WithMaxRows(ctx context.Context, n int64) context.Context {
+	return withQueryOptions(ctx, func(o *queryOptions) {
+		o.maxRows = n
+	})
+}
+
+// WithPrefetch returns a context that overrides the prefetch_pages DSN
+// parameter for queries started with it: up to pages pages of results are
+// fetched in the background while the rows are read, 0 disables it.
+func WithPrefetch(ctx context.Context, pages int) context.Context {
+	return withQueryOptions(ctx, func(o *queryOptions) {
+		o.prefetchPages = pages
+		o.prefetchSet = true
+	})
+}
+
+// WithQueryTimeout returns a context that limits queries started with it,
+// including the iteration over their results, to d.
+func WithQueryTimeout(ctx context.Context, d time.Duration) context.Context {
+	return withQueryOptions(ctx, func(o *queryOptions) {
+		o.timeout = d
+	})
+}
@@ -0,0 +1,486 @@
+package trino
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"unicode/utf8"
+)
+
+// columnDecoder decodes a JSON value of the data array of a page of results
+// into the value returned by driverRows.Next for its column. It returns
+// false when the value is not in the form it expects, in which case it is
+// decoded by decodeGeneric instead.
+type columnDecoder func(raw []byte) (driver.Value, bool)
+
+// newColumnDecoder returns the decoder for the values of the given parsed
+// type, or nil when they must go through decodeGeneric.
+func newColumnDecoder(parsedType []string) columnDecoder {
+	switch parsedType[0] {
+	case "boolean":
+		return decodeBool
+	case "json", "char", "varchar", "varbinary", "interval year to month", "interval day to second", "decimal", "ipaddress", "unknown":
+		return decodeString
+	case "tinyint", "smallint", "integer", "bigint":
+		return decodeInt64
+	case "real", "double":
+		return decodeFloat64
+	case "date", "time", "time with time zone", "timestamp", "timestamp with time zone":
+		return decodeTime
+	}
+	return nil
+}
+
+var (
+	jsonNull  = []byte("null")
+	jsonTrue  = []byte("true")
+	jsonFalse = []byte("false")
+)
+
+func decodeBool(raw []byte) (driver.Value, bool) {
+	switch {
+	case bytes.Equal(raw, jsonNull):
+		return nil, true
+	case bytes.Equal(raw, jsonTrue):
+		return true, true
+	case bytes.Equal(raw, jsonFalse):
+		return false, true
+	}
+	return nil, false
+}
+
+func decodeString(raw []byte) (driver.Value, bool) {
+	if bytes.Equal(raw, jsonNull) {
+		return nil, true
+	}
+	s, ok := unquote(raw)
+	if !ok {
+		return nil, false
+	}
+	return s, true
+}
+
+func decodeInt64(raw []byte) (driver.Value, bool) {
+	if bytes.Equal(raw, jsonNull) {
+		return nil, true
+	}
+	digits := raw
+	if len(digits) > 0 && digits[0] == '-' {
+		digits = digits[1:]
+	}
+	// 18 digits can't overflow an int64, longer values are left to strconv
+	if len(digits) == 0 || len(digits) > 18 || (digits[0] == '0' && len(digits) > 1) {
+		return nil, false
+	}
+	var n int64
+	for _, c := range digits {
+		if c < '0' || c > '9' {
+			return nil, false
+		}
+		n = n*10 + int64(c-'0')
+	}
+	if len(digits) < len(raw) {
+		n = -n
+	}
+	return n, true
+}
+
+func decodeFloat64(raw []byte) (driver.Value, bool) {
+	if bytes.Equal(raw, jsonNull) {
+		return nil, true
+	}
+	if len(raw) > 0 && raw[0] == '"' {
+		switch string(raw) {
+		case `"NaN"`:
+			return math.NaN(), true
+		case `"Infinity"`:
+			return math.Inf(+1), true
+		case `"-Infinity"`:
+			return math.Inf(-1), true
+		}
+		return nil, false
+	}
+	if len(raw) == 0 || (raw[0] != '-' && (raw[0] < '0' || raw[0] > '9')) {
+		return nil, false
+	}
+	f, err := strconv.ParseFloat(string(raw), 64)
+	if err != nil {
+		return nil, false
+	}
+	return f, true
+}
+
+func decodeTime(raw []byte) (driver.Value, bool) {
+	if bytes.Equal(raw, jsonNull) {
+		return nil, true
+	}
+	s, ok := unquote(raw)
+	if !ok {
+		return nil, false
+	}
+	t, err := parseNullTimeString(s)
+	if err != nil {
+		return nil, false
+	}
+	return t.Time, true
+}
+
+// unquote returns the string in raw when it is a JSON string that has no
+// escape sequences and is valid UTF-8, which covers most of them.
+func unquote(raw []byte) (string, bool) {
+	if len(raw) < 2 || raw[0] != '"' || raw[len(raw)-1] != '"' {
+		return "", false
+	}
+	raw = raw[1 : len(raw)-1]
+	for _, c := range raw {
+		if c == '\\' || c == '"' || c < ' ' {
+			return "", false
+		}
+	}
+	if !utf8.Valid(raw) {
+		return "", false
+	}
+	return string(raw), true
+}
+
+// decodeGeneric decodes a value with encoding/json and converts it with
+// ConvertValue. It handles the types that have no column decoder, such as
+// arrays and maps, as well as unexpected values, for which it returns the
+// conversion error.
+func decodeGeneric(raw []byte, c *typeConverter) (driver.Value, error) {
+	var v interface{}
+	d := json.NewDecoder(bytes.NewReader(raw))
+	d.UseNumber()
+	if err := d.Decode(&v); err != nil {
+		return nil, fmt.Errorf("trino: %v", err)
+	}
+	return c.ConvertValue(v)
+}
+
+// decodeData decodes the data array of a page of results, appending the
+// values of its rows to values and returning them with the number of rows.
+// The array is tokenized in place and every value is decoded by the decoder
+// of its column, skipping the interface{} values, json.Number boxing and
+// per-value type switch of decoding the page with encoding/json.
+func decodeData(values []driver.Value, data []byte, coltype []*typeConverter) ([]driver.Value, int, error) {
+	s := dataScanner{buf: data}
+	s.skipSpace()
+	if s.pos == len(s.buf) || s.consume(jsonNull) {
+		return values, 0, s.end()
+	}
+	values, rows, err := s.rows(values, coltype)
+	if err != nil {
+		return values, rows, err
+	}
+	return values, rows, s.end()
+}
+
+// readQueryResponse decodes a response to a submit or poll request as it is
+// read from body. The rows of its data array are decoded on the way, with
+// coltype or, when it is nil, with the columns sent before the data in the
+// response, so that the page isn't held as raw JSON and scanned twice. The
+// data is left in Data when its columns aren't known yet or when it is sent
+// with the spooling protocol.
+func readQueryResponse(body io.Reader, coltype []*typeConverter, values []driver.Value) (*queryResponse, error) {
+	s := dataScanner{r: body, buf: make([]byte, 0, 32<<10)}
+	qresp := &queryResponse{values: values}
+	// the other members are decoded with encoding/json once the object is
+	// read
+	var meta bytes.Buffer
+	meta.WriteByte('{')
+	if !s.consumeByte('{') {
+		return nil, s.errorf("expected response object")
+	}
+	for first := true; !s.consumeByte('}'); first = false {
+		if !first && !s.consumeByte(',') {
+			return nil, s.errorf("expected , or } after member")
+		}
+		raw, err := s.value()
+		if err != nil {
+			return nil, err
+		}
+		key, ok := unquote(raw)
+		if !ok {
+			return nil, s.errorf("expected member name")
+		}
+		if key != "data" && key != "columns" {
+			if meta.Len() > 1 {
+				meta.WriteByte(',')
+			}
+			meta.Write(raw)
+		}
+		if !s.consumeByte(':') {
+			return nil, s.errorf("expected : after member name")
+		}
+		switch key {
+		case "columns":
+			if raw, err = s.value(); err != nil {
+				return nil, err
+			}
+			if err := unmarshalNumber(raw, &qresp.Columns); err != nil {
+				return nil, err
+			}
+			continue
+		case "data":
+			if coltype == nil && qresp.Columns != nil {
+				coltype = make([]*typeConverter, len(qresp.Columns))
+				for i, col := range qresp.Columns {
+					coltype[i] = newTypeConverter(col.Type)
+				}
+				qresp.coltype = coltype
+			}
+			if coltype != nil && s.pos < len(s.buf) && s.buf[s.pos] == '[' {
+				qresp.values, qresp.rowcount, err = s.rows(qresp.values, coltype)
+				if err != nil {
+					return nil, err
+				}
+				continue
+			}
+			if raw, err = s.value(); err != nil {
+				return nil, err
+			}
+			qresp.Data = append(json.RawMessage(nil), raw...)
+			continue
+		}
+		if raw, err = s.value(); err != nil {
+			return nil, err
+		}
+		meta.WriteByte(':')
+		meta.Write(raw)
+	}
+	if err := s.end(); err != nil {
+		return nil, err
+	}
+	meta.WriteByte('}')
+	if err := unmarshalNumber(meta.Bytes(), qresp); err != nil {
+		return nil, err
+	}
+	return qresp, nil
+}
+
+// unmarshalNumber decodes raw into v, with the numbers of interface{} values
+// decoded as json.Number.
+func unmarshalNumber(raw []byte, v interface{}) error {
+	d := json.NewDecoder(bytes.NewReader(raw))
+	d.UseNumber()
+	if err := d.Decode(v); err != nil {
+		return fmt.Errorf("trino: %v", err)
+	}
+	return nil
+}
+
+// rows decodes the array of rows that is next, appending their values to
+// values.
+func (s *dataScanner) rows(values []driver.Value, coltype []*typeConverter) ([]driver.Value, int, error) {
+	if !s.consumeByte('[') {
+		return values, 0, s.errorf("expected data array")
+	}
+	rows := 0
+	for first := true; !s.consumeByte(']'); first = false {
+		if !first && !s.consumeByte(',') {
+			return values, rows, s.errorf("expected , or ] after row")
+		}
+		if len(coltype) == 0 {
+			// rows sent before the columns are only counted, Next reports
+			// them with sql.ErrNoRows
+			raw, err := s.value()
+			if err != nil {
+				return values, rows, err
+			}
+			if raw[0] != '[' {
+				return values, rows, s.errorf("expected row array")
+			}
+			rows++
+			continue
+		}
+		if !s.consumeByte('[') {
+			return values, rows, s.errorf("expected row array")
+		}
+		for i, c := range coltype {
+			if i > 0 && !s.consumeByte(',') {
+				return values, rows, s.errorf("row has %d values, want %d", i, len(coltype))
+			}
+			raw, err := s.value()
+			if err != nil {
+				return values, rows, err
+			}
+			var v driver.Value
+			ok := false
+			if c.decode != nil {
+				v, ok = c.decode(raw)
+			}
+			if !ok {
+				if v, err = decodeGeneric(raw, c); err != nil {
+					return values, rows, err
+				}
+			}
+			values = append(values, v)
+		}
+		if !s.consumeByte(']') {
+			return values, rows, s.errorf("row has more than %d values", len(coltype))
+		}
+		rows++
+	}
+	return values, rows, nil
+}
+
+// dataScanner tokenizes JSON in place. When it reads from r, buf holds the
+// part of the input being scanned, from the start of the last value
+// returned: the values are only valid until the scanner is used again.
+type dataScanner struct {
+	r    io.Reader // nil when buf holds the whole input
+	err  error     // of r, once it ended
+	buf  []byte
+	pos  int
+	mark int // in buf, of the start of the last value
+	off  int // of buf in the input
+}
+
+// fill reads more of the input into buf, keeping the last value. It
+// reports whether anything was read.
+func (s *dataScanner) fill() bool {
+	if s.r == nil || s.err != nil {
+		return false
+	}
+	if s.mark > 0 {
+		n := copy(s.buf, s.buf[s.mark:])
+		s.buf = s.buf[:n]
+		s.pos -= s.mark
+		s.off += s.mark
+		s.mark = 0
+	}
+	if len(s.buf) == cap(s.buf) {
+		buf := make([]byte, len(s.buf), 2*cap(s.buf)+512)
+		copy(buf, s.buf)
+		s.buf = buf
+	}
+	for {
+		n, err := s.r.Read(s.buf[len(s.buf):cap(s.buf)])
+		s.buf = s.buf[:len(s.buf)+n]
+		if err != nil {
+			s.err = err
+		}
+		if n > 0 || err != nil {
+			return n > 0
+		}
+	}
+}
+
+func (s *dataScanner) skipSpace() {
+	for s.pos < len(s.buf) || s.fill() {
+		switch s.buf[s.pos] {
+		case ' ', '\t', '\n', '\r':
+			s.pos++
+		default:
+			return
+		}
+	}
+}
+
+// consumeByte skips c and the spaces around it, if c is next.
+func (s *dataScanner) consumeByte(c byte) bool {
+	s.skipSpace()
+	if s.pos < len(s.buf) && s.buf[s.pos] == c {
+		s.pos++
+		s.skipSpace()
+		return true
+	}
+	return false
+}
+
+// consume skips lit, if it is next.
+func (s *dataScanner) consume(lit []byte) bool {
+	for len(s.buf)-s.pos < len(lit) && s.fill() {
+	}
+	if bytes.HasPrefix(s.buf[s.pos:], lit) {
+		s.pos += len(lit)
+		s.skipSpace()
+		return true
+	}
+	return false
+}
+
+func (s *dataScanner) end() error {
+	s.skipSpace()
+	if s.pos != len(s.buf) {
+		return s.errorf("unexpected data after the data array")
+	}
+	return nil
+}
+
+// value returns the next value, without checking more than needed to find
+// where it ends: its decoder reports the invalid ones.
+func (s *dataScanner) value() ([]byte, error) {
+	s.skipSpace()
+	s.mark = s.pos
+	depth := 0
+	for s.pos < len(s.buf) || s.fill() {
+		c := s.buf[s.pos]
+		switch {
+		case c == '"':
+			if err := s.skipString(); err != nil {
+				return nil, err
+			}
+			if depth == 0 {
+				return s.buf[s.mark:s.pos], nil
+			}
+			continue
+		case c == '[' || c == '{':
+			depth++
+		case c == ']' || c == '}':
+			if depth == 0 {
+				return s.token()
+			}
+			depth--
+			if depth == 0 {
+				s.pos++
+				return s.buf[s.mark:s.pos], nil
+			}
+		case c == ',' || c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			if depth == 0 {
+				return s.token()
+			}
+		}
+		s.pos++
+	}
+	if depth > 0 {
+		return nil, s.errorf("unexpected end of data")
+	}
+	return s.token()
+}
+
+func (s *dataScanner) token() ([]byte, error) {
+	if s.pos == s.mark {
+		return nil, s.errorf("expected value")
+	}
+	return s.buf[s.mark:s.pos], nil
+}
+
+func (s *dataScanner) skipString() error {
+	escaped := false
+	for s.pos++; s.pos < len(s.buf) || s.fill(); s.pos++ {
+		switch c := s.buf[s.pos]; {
+		case escaped:
+			escaped = false
+		case c == '\\':
+			escaped = true
+		case c == '"':
+			s.pos++
+			return nil
+		}
+	}
+	return s.errorf("unterminated string")
+}
+
+// errorf returns the error of reading the input if it failed, or else the
+// error of invalid data at the current position.
+func (s *dataScanner) errorf(format string, args ...interface{}) error {
+	if s.err != nil && s.err != io.EOF {
+		return fmt.Errorf("trino: %v", s.err)
+	}
+	return fmt.Errorf("trino: invalid data at offset %d: %s", s.off+s.pos, fmt.Sprintf(format, args...))
+}
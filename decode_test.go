@@ -0,0 +1,261 @@
+package trino
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+)
+
+func TestDecodeData(t *testing.T) {
+	types := []string{"bigint", "double", "varchar(10)", "boolean", "timestamp", "array(bigint)", "map(varchar,bigint)"}
+	data := `[
+		[1, 1.5, "a", true, "2017-07-10 01:02:03.004", [1, 2], {"k": 1}],
+		[-9223372036854775808, "NaN", "café \"quoted\"", false, "2017-07-10 01:02:03.004 UTC", [], {}],
+		[null, null, null, null, null, null, null]
+	]`
+	coltype := make([]*typeConverter, len(types))
+	for i, name := range types {
+		coltype[i] = newTypeConverter(name)
+	}
+	got, rows, err := decodeData(nil, []byte(data), coltype)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rows != 3 {
+		t.Fatalf("got %d rows, want 3", rows)
+	}
+	// the values must be the same as the ones of the generic decoding
+	var generic [][]interface{}
+	d := json.NewDecoder(strings.NewReader(data))
+	d.UseNumber()
+	if err := d.Decode(&generic); err != nil {
+		t.Fatal(err)
+	}
+	for r, row := range generic {
+		for i, v := range row {
+			want, err := coltype[i].ConvertValue(v)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := got[r*len(types)+i]
+			if f, ok := want.(float64); ok && math.IsNaN(f) {
+				if g, ok := got.(float64); !ok || !math.IsNaN(g) {
+					t.Errorf("row %d column %d: got %#v, want NaN", r, i, got)
+				}
+				continue
+			}
+			if wt, ok := want.(time.Time); ok {
+				if gt, ok := got.(time.Time); !ok || !gt.Equal(wt) {
+					t.Errorf("row %d column %d: got %#v, want %v", r, i, got, wt)
+				}
+				continue
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("row %d column %d: got %#v, want %#v", r, i, got, want)
+			}
+		}
+	}
+}
+
+func TestDecodeDataErrors(t *testing.T) {
+	coltype := []*typeConverter{newTypeConverter("bigint"), newTypeConverter("varchar")}
+	for _, data := range []string{
+		`[[1, "a"], [2]]`,
+		`[[1, "a", 3]]`,
+		`[[1.5, "a"]]`,
+		`[["1", "a"]]`,
+		`[[1, 2]]`,
+		`[[1, "a"]`,
+		`[[1, "a]]`,
+		`[[1, "a"]] x`,
+		`{}`,
+	} {
+		if _, _, err := decodeData(nil, []byte(data), coltype); err == nil {
+			t.Errorf("%s: no error", data)
+		}
+	}
+	for _, data := range []string{"", "null", "[]", " [ ] "} {
+		if _, rows, err := decodeData(nil, []byte(data), coltype); err != nil || rows != 0 {
+			t.Errorf("%q: got %d rows and error %v", data, rows, err)
+		}
+	}
+}
+
+func TestReadQueryResponse(t *testing.T) {
+	data, coltype := benchmarkPage(50)
+	want, _, err := decodeData(nil, data, coltype)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := benchmarkResponse(50)
+	for name, r := range map[string]io.Reader{
+		"whole":    bytes.NewReader(body),
+		"one byte": iotest.OneByteReader(bytes.NewReader(body)),
+	} {
+		qresp, err := readQueryResponse(r, nil, nil)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if qresp.ID != "q1" || qresp.Stats.State != "RUNNING" || len(qresp.Columns) != 5 || qresp.NextURI == "" {
+			t.Errorf("%s: got response %+v", name, qresp)
+		}
+		if qresp.Data != nil || len(qresp.coltype) != 5 {
+			t.Errorf("%s: data left raw", name)
+		}
+		if qresp.rowcount != 50 || !reflect.DeepEqual(qresp.values, want) {
+			t.Errorf("%s: got %d rows with values %v, want 50 rows with %v", name, qresp.rowcount, qresp.values, want)
+		}
+	}
+
+	// the data is left raw when its columns aren't known
+	for _, body := range []string{
+		`{"id": "q1", "data": [[1]], "columns": [{"name": "n", "type": "bigint"}]}`,
+		`{"id": "q1", "data": {"encoding": "json", "segments": []}, "columns": [{"name": "n", "type": "bigint"}]}`,
+	} {
+		qresp, err := readQueryResponse(strings.NewReader(body), nil, nil)
+		if err != nil {
+			t.Fatalf("%s: %v", body, err)
+		}
+		if qresp.Data == nil || qresp.rowcount != 0 || len(qresp.Columns) != 1 {
+			t.Errorf("%s: got response %+v", body, qresp)
+		}
+	}
+	qresp, err := readQueryResponse(strings.NewReader(`{"data": [[1], [2]]}`), coltype[:1], nil)
+	if err != nil || qresp.rowcount != 2 || !reflect.DeepEqual(qresp.values, []driver.Value{int64(1), int64(2)}) {
+		t.Errorf("got response %+v and error %v, want the rows decoded with the given columns", qresp, err)
+	}
+
+	for _, body := range []string{
+		``,
+		`[]`,
+		`{"id": "q1"`,
+		`{"id" "q1"}`,
+		`{"id": "q1",}`,
+		`{"columns": [{"name": "n", "type": "bigint"}], "data": [[1, 2]]}`,
+		`{"stats": {"state": 1}}`,
+		`{"id": "q1"} x`,
+	} {
+		if _, err := readQueryResponse(strings.NewReader(body), nil, nil); err == nil {
+			t.Errorf("%q: no error", body)
+		}
+	}
+	_, err = readQueryResponse(iotest.TimeoutReader(iotest.OneByteReader(bytes.NewReader(body))), nil, nil)
+	if err == nil || !strings.Contains(err.Error(), iotest.ErrTimeout.Error()) {
+		t.Errorf("got error %v, want the read error", err)
+	}
+}
+
+func TestDecodeDataWithoutColumns(t *testing.T) {
+	values, rows, err := decodeData(nil, []byte(`[[1, "a"], [2, "b"]]`), nil)
+	if err != nil || rows != 2 || len(values) != 0 {
+		t.Errorf("got %d rows, %d values and error %v, want 2 rows without values", rows, len(values), err)
+	}
+	if _, _, err := decodeData(nil, []byte(`[1]`), nil); err == nil {
+		t.Error("row that isn't an array accepted")
+	}
+}
+
+// benchmarkPage is a page of results of a typical export.
+func benchmarkPage(rows int) ([]byte, []*typeConverter) {
+	var b bytes.Buffer
+	b.WriteByte('[')
+	for i := 0; i < rows; i++ {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, `[%d,%d.25,"name %d",%t,"2017-07-10 01:02:03.004"]`, i, i, i, i%2 == 0)
+	}
+	b.WriteByte(']')
+	coltype := []*typeConverter{
+		newTypeConverter("bigint"),
+		newTypeConverter("double"),
+		newTypeConverter("varchar"),
+		newTypeConverter("boolean"),
+		newTypeConverter("timestamp"),
+	}
+	return b.Bytes(), coltype
+}
+
+// benchmarkResponse is a response to a poll request with a page of results
+// of a typical export.
+func benchmarkResponse(rows int) []byte {
+	data, _ := benchmarkPage(rows)
+	return []byte(`{"id":"q1","infoUri":"http://localhost/ui/query.html?q1",` +
+		`"nextUri":"http://localhost/v1/statement/executing/q1/y/2",` +
+		`"columns":[{"name":"id","type":"bigint"},{"name":"score","type":"double"},` +
+		`{"name":"name","type":"varchar"},{"name":"even","type":"boolean"},{"name":"at","type":"timestamp"}],` +
+		`"data":` + string(data) + `,"stats":{"state":"RUNNING","processedRows":1000}}`)
+}
+
+// BenchmarkReadResponseGeneric reads responses the way the driver used to:
+// with encoding/json into interface{} values, converted one at a time.
+func BenchmarkReadResponseGeneric(b *testing.B) {
+	body := benchmarkResponse(1000)
+	_, coltype := benchmarkPage(0)
+	b.SetBytes(int64(len(body)))
+	b.ReportAllocs()
+	dest := make([]driver.Value, len(coltype))
+	for i := 0; i < b.N; i++ {
+		var qresp struct {
+			queryResponse
+			Data [][]interface{} `json:"data"`
+		}
+		d := json.NewDecoder(bytes.NewReader(body))
+		d.UseNumber()
+		if err := d.Decode(&qresp); err != nil {
+			b.Fatal(err)
+		}
+		for _, row := range qresp.Data {
+			for j, c := range coltype {
+				v, err := c.ConvertValue(row[j])
+				if err != nil {
+					b.Fatal(err)
+				}
+				dest[j] = v
+			}
+		}
+	}
+}
+
+// BenchmarkReadResponseTwoPass reads responses with encoding/json, leaving
+// the data raw to be decoded by the column decoders.
+func BenchmarkReadResponseTwoPass(b *testing.B) {
+	body := benchmarkResponse(1000)
+	_, coltype := benchmarkPage(0)
+	b.SetBytes(int64(len(body)))
+	b.ReportAllocs()
+	var values []driver.Value
+	for i := 0; i < b.N; i++ {
+		var qresp queryResponse
+		if err := unmarshalNumber(body, &qresp); err != nil {
+			b.Fatal(err)
+		}
+		var err error
+		if values, _, err = decodeData(values[:0], qresp.Data, coltype); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkReadResponse(b *testing.B) {
+	body := benchmarkResponse(1000)
+	_, coltype := benchmarkPage(0)
+	b.SetBytes(int64(len(body)))
+	b.ReportAllocs()
+	var values []driver.Value
+	for i := 0; i < b.N; i++ {
+		qresp, err := readQueryResponse(bytes.NewReader(body), coltype, values[:0])
+		if err != nil {
+			b.Fatal(err)
+		}
+		values = qresp.values
+	}
+}
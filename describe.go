@@ -0,0 +1,116 @@
+package trino
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+)
+
+// Parameter is a parameter of a query, as described by DESCRIBE INPUT.
+type Parameter struct {
+	Position   int    // from 0, in the order of the ? in the query
+	Type       string // e.g. bigint, or unknown when it can't be inferred
+	ParsedType Type
+}
+
+// OutputColumn is a column of the results of a query, as described by
+// DESCRIBE OUTPUT.
+type OutputColumn struct {
+	Name       string
+	Type       string // e.g. varchar(25)
+	ParsedType Type
+	Catalog    string // of the table the column comes from, empty for expressions
+	Schema     string
+	Table      string
+	TypeSize   int64 // in bytes, 0 for types of variable width
+	Aliased    bool  // whether the column is named with AS in the query
+}
+
+// DescribeInput prepares query without running it and returns its
+// parameters, failing like the query would for syntax or semantic errors.
+func DescribeInput(ctx context.Context, db *sql.DB, query string) ([]Parameter, error) {
+	var params []Parameter
+	err := describe(ctx, db, "INPUT", query, 2, func(row []driver.Value) error {
+		position, ok := row[0].(int64)
+		if !ok {
+			return fmt.Errorf("trino: unexpected position in DESCRIBE INPUT: %v", row[0])
+		}
+		p := Parameter{Position: int(position), Type: describedString(row[1])}
+		p.ParsedType = parseTypeOrName(p.Type)
+		params = append(params, p)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return params, nil
+}
+
+// DescribeOutput prepares query without running it and returns the columns
+// of its results, failing like the query would for syntax or semantic
+// errors. Statements without results, e.g. INSERT, have no columns.
+func DescribeOutput(ctx context.Context, db *sql.DB, query string) ([]OutputColumn, error) {
+	var columns []OutputColumn
+	err := describe(ctx, db, "OUTPUT", query, 7, func(row []driver.Value) error {
+		c := OutputColumn{
+			Name:    describedString(row[0]),
+			Type:    describedString(row[4]),
+			Catalog: describedString(row[1]),
+			Schema:  describedString(row[2]),
+			Table:   describedString(row[3]),
+		}
+		c.ParsedType = parseTypeOrName(c.Type)
+		c.TypeSize, _ = row[5].(int64)
+		c.Aliased, _ = row[6].(bool)
+		columns = append(columns, c)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return columns, nil
+}
+
+// describe runs DESCRIBE INPUT or DESCRIBE OUTPUT on query, prepared for
+// the statement, and calls scan with each row of at least width columns.
+func describe(ctx context.Context, db *sql.DB, kind, query string, width int, scan func([]driver.Value) error) error {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return conn.Raw(func(driverConn interface{}) error {
+		c, ok := driverConn.(*Conn)
+		if !ok {
+			return fmt.Errorf("trino: DESCRIBE %s needs a Trino database, got a %T connection", kind, driverConn)
+		}
+		st := &driverStmt{conn: c, query: "DESCRIBE " + kind + " " + _preparedStatementName, prepared: query}
+		rows, err := st.QueryContext(ctx, nil)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		row := make([]driver.Value, len(rows.Columns()))
+		if len(row) < width {
+			return fmt.Errorf("trino: unexpected columns in DESCRIBE %s: %q", kind, rows.Columns())
+		}
+		for {
+			if err := rows.Next(row); err != nil {
+				if err == io.EOF || err == sql.ErrNoRows {
+					return nil
+				}
+				return err
+			}
+			if err := scan(row); err != nil {
+				return err
+			}
+		}
+	})
+}
+
+func describedString(v driver.Value) string {
+	s, _ := v.(string)
+	return s
+}
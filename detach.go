@@ -0,0 +1,188 @@
+package trino
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// QueryHandle identifies a query submitted with Client.SubmitDetached, so
+// that it can be resumed, or its status checked, from another process. It
+// is serialized with encoding/json.
+//
+// Trino fails the queries whose results are not fetched for
+// query.client.timeout, 5 minutes by default, so a detached query must be
+// resumed within that time; checking its status doesn't count.
+//
+// A handle holds no credentials: the client resuming the query must
+// authenticate as the principal that submitted it. As the client sends its
+// credentials to the URIs of the handle, handles must be kept in a trusted
+// store.
+type QueryHandle struct {
+	QueryID string `json:"queryId"`
+	NextURI string `json:"nextUri,omitempty"` // empty once the query is over
+	Server  string `json:"server"`            // base URL of the coordinator running the query
+	User    string `json:"user,omitempty"`    // the user the query runs as, when set per query
+	// AuthRef is a reference to the credentials to resume the query with,
+	// e.g. the name of a secret, set by the caller and ignored by the
+	// driver.
+	AuthRef string `json:"authRef,omitempty"`
+}
+
+// SubmitDetached submits a query and returns its handle once Trino
+// dispatched it, without fetching any results. The query keeps running
+// after the handle is returned, see QueryHandle. Detached queries are not
+// reported to the Metrics of the connector.
+func (c *Client) SubmitDetached(ctx context.Context, query string, opts *QueryOptions) (*QueryHandle, error) {
+	ctx = withQueryOptions(ctx, func(o *queryOptions) {
+		o.detached = true
+	})
+	q, err := c.Submit(ctx, query, opts)
+	if err != nil {
+		return nil, err
+	}
+	qr := q.rows
+	// Trino only dispatches a query once its queued URI is polled, the
+	// pages following it may hold results
+	for isQueuedURI(qr.nextURI) {
+		qresp, statusCode, err := qr.get(qr.ctx, qr.nextURI, qr.queryID, nil, nil)
+		if err == nil {
+			err = handleResponseError(statusCode, qresp.Error)
+		}
+		if err != nil {
+			qr.tracker.failed(err)
+			q.Cancel()
+			return nil, err
+		}
+		qr.tracker.update(qresp.Stats, qresp.Warnings)
+		qr.stats = qresp.Stats
+		qr.nextURI = qresp.NextURI
+		qr.canceller.update(qr.nextURI)
+	}
+	h := &QueryHandle{
+		QueryID: qr.queryID,
+		NextURI: qr.nextURI,
+		Server:  qr.server,
+		User:    qr.user,
+	}
+	// release the query locally, without cancelling it
+	qr.canceller.update("")
+	qr.tracker.done = true
+	qr.nextURI = ""
+	qr.Close()
+	q.cancel()
+	return h, nil
+}
+
+// isQueuedURI reports whether uri is the nextUri of a query that Trino
+// didn't dispatch yet.
+func isQueuedURI(uri string) bool {
+	u, err := url.Parse(uri)
+	return err == nil && strings.HasPrefix(u.Path, "/v1/statement/queued/")
+}
+
+// Resume continues a query from its handle. Its results are read from the
+// page following the last one fetched when the handle was made. The query
+// is reported to the QueryListener of the client and of ctx as if it was
+// submitted before.
+func (c *Client) Resume(ctx context.Context, h *QueryHandle) (*Query, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	opts := queryOptionsFromContext(ctx)
+	tracker := c.conn.newQueryTracker(opts)
+	tracker.queryID = h.QueryID
+	qr := &driverRows{
+		ctx:      ctx,
+		stmt:     &driverStmt{conn: c.conn},
+		server:   h.Server,
+		user:     h.User,
+		callback: opts.callback,
+		tracker:  tracker,
+		prefetch: c.conn.prefetchPages,
+		nextURI:  h.NextURI,
+		queryID:  h.QueryID,
+	}
+	if opts.prefetchSet {
+		qr.prefetch = opts.prefetchPages
+	}
+	qr.canceller = newQueryCanceller(c.conn, h.Server, qr.headers(), h.QueryID, h.NextURI)
+	qr.canceller.watch(ctx)
+	if h.NextURI != "" {
+		c.conn.trackRows(qr)
+		if err := qr.fetch(false); err != nil {
+			qr.Close()
+			cancel()
+			return nil, err
+		}
+	}
+	return &Query{rows: qr, cancel: cancel}, nil
+}
+
+// QueryStatus is the status of a query, as reported by the coordinator.
+type QueryStatus struct {
+	QueryID      string
+	State        string // e.g. QUEUED, RUNNING, FINISHED or FAILED
+	Done         bool   // the query finished or failed
+	UpdateType   string // e.g. CREATE TABLE
+	ErrorType    string // set when the query failed, e.g. USER_ERROR
+	ErrorName    string
+	ErrorMessage string
+	// Info is the whole document returned by /v1/query/{id}.
+	Info json.RawMessage
+}
+
+// queryInfo is the part of the response of /v1/query/{id} decoded into a
+// QueryStatus.
+type queryInfo struct {
+	QueryID    string `json:"queryId"`
+	State      string `json:"state"`
+	UpdateType string `json:"updateType"`
+	ErrorType  string `json:"errorType"`
+	ErrorCode  struct {
+		Name string `json:"name"`
+	} `json:"errorCode"`
+	FailureInfo struct {
+		Message string `json:"message"`
+	} `json:"failureInfo"`
+}
+
+// Status returns the status of a query from its handle, without fetching
+// its results.
+func (c *Client) Status(ctx context.Context, h *QueryHandle) (*QueryStatus, error) {
+	hs := make(http.Header)
+	if h.User != "" {
+		hs.Set(vhs[v]["user"], h.User)
+	}
+	req, err := c.conn.newRequest("GET", h.Server+"/v1/query/"+url.PathEscape(h.QueryID), nil, hs)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.conn.do(ctx, &Request{Request: req.WithContext(ctx), Phase: PhaseInfo, QueryID: h.QueryID})
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, newErrQueryFailedFromResponse(resp.Response)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, &ErrQueryFailed{StatusCode: resp.StatusCode, Reason: err}
+	}
+	var info queryInfo
+	if err := json.Unmarshal(body, &info); err != nil {
+		return nil, &ErrQueryFailed{StatusCode: resp.StatusCode, Reason: err}
+	}
+	return &QueryStatus{
+		QueryID:      info.QueryID,
+		State:        info.State,
+		Done:         info.State == "FINISHED" || info.State == "FAILED",
+		UpdateType:   info.UpdateType,
+		ErrorType:    info.ErrorType,
+		ErrorName:    info.ErrorCode.Name,
+		ErrorMessage: info.FailureInfo.Message,
+		Info:         body,
+	}, nil
+}
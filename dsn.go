@@ -9,18 +9,40 @@ import (
 
 // Config is a configuration that can be encoded to a DSN string.
 type Config struct {
-	ServerURI          string            // URI of the Trino server, e.g. http://user@localhost:8080
-	Source             string            // Source of the connection (optional)
-	Catalog            string            // Catalog (optional)
-	Schema             string            // Schema (optional)
-	SessionProperties  map[string]string // Session properties (optional)
-	CustomClientName   string            // Custom client name (optional)
-	KerberosEnabled    string            // KerberosEnabled (optional, default is false)
-	KerberosKeytabPath string            // Kerberos Keytab Path (optional)
-	KerberosPrincipal  string            // Kerberos Principal used to authenticate to KDC (optional)
-	KerberosRealm      string            // The Kerberos Realm (optional)
-	KerberosConfigPath string            // The krb5 config path (optional)
-	SSLCertPath        string            // The SSL cert path for TLS verification (optional)
+	ServerURI                       string            // URI of the Trino server, e.g. http://user@localhost:8080
+	Source                          string            // Source of the connection (optional)
+	Catalog                         string            // Catalog (optional)
+	Schema                          string            // Schema (optional)
+	SessionProperties               map[string]string // Session properties (optional)
+	CustomClientName                string            // Custom client name (optional)
+	KerberosEnabled                 string            // KerberosEnabled (optional, default is false)
+	KerberosKeytabPath              string            // Kerberos Keytab Path (optional)
+	KerberosCredentialCachePath     string            // Kerberos credential cache path, used instead of the keytab (optional)
+	KerberosPrincipal               string            // Kerberos Principal used to authenticate to KDC (optional)
+	KerberosRealm                   string            // The Kerberos Realm (optional)
+	KerberosConfigPath              string            // The krb5 config path (optional)
+	KerberosRemoteServiceName       string            // Service name of the Trino coordinator principal (optional, default is presto)
+	KerberosServicePrincipalPattern string            // Pattern of the coordinator principal, ${SERVICE}@${HOST} meaning ${SERVICE}/${HOST} (optional, default is ${SERVICE}/${HOST})
+	KerberosUseCanonicalHostname    string            // Resolve the canonical coordinator hostname for the principal (optional, default is false)
+	SSLCertPath                     string            // The SSL cert path for TLS verification (optional)
+	ClientTags                      []string          // Client tags, e.g. for resource group selection (optional)
+	ClientInfo                      string            // Extra information about the client (optional)
+	TraceToken                      string            // Trace token for correlating requests in the server logs (optional)
+	Roles                           map[string]string // Role to set per catalog, or ALL or NONE (optional)
+	ExtraCredentials                map[string]string // Extra credentials passed to connectors (optional)
+	TimeZone                        string            // Session time zone, e.g. America/New_York (optional)
+	Language                        string            // Session language, e.g. en-US (optional)
+	Path                            string            // SQL path for resolving functions (optional)
+	ResourceEstimates               map[string]string // Resource estimates, e.g. EXECUTION_TIME=5m (optional)
+	WarningsAsErrors                []string          // Names of warnings that fail the query, e.g. DEPRECATED_FUNCTION (optional)
+	PingQuery                       string            // Query run by Ping when /v1/info is not available, e.g. SELECT 1 (optional)
+	PrefetchPages                   int               // Number of pages of results fetched ahead of the rows being read (optional, default is 0)
+	Encoding                        []string          // Spooling protocol encodings in order of preference, e.g. json+lz4 and json (optional, default is the classic protocol)
+	SpoolingWorkers                 int               // Number of spooled segments downloaded at the same time (optional, default is DefaultSpoolingWorkers)
+	RewriteURIs                     bool              // Send the requests following the first one to the host that accepted the query, whichever host the coordinator advertises (optional)
+	Hosts                           []string          // Other coordinators, as host[:port], to fail over to (optional)
+	HostSelection                   string            // How queries are spread over the hosts, HostSelectionPriority or HostSelectionRoundRobin (optional, default is priority)
+	Debug                           string            // Debug logs of the requests to the coordinator, DebugRequests or DebugSQL (optional)
 }
 
 // FormatDSN returns a DSN string from the configuration.
@@ -55,6 +77,16 @@ func (c *Config) FormatDSN() (string, error) {
 		query.Add(_kerberosPrincipalConfig, c.KerberosPrincipal)
 		query.Add(_kerberosRealmConfig, c.KerberosRealm)
 		query.Add(_kerberosConfigPathConfig, c.KerberosConfigPath)
+		for k, v := range map[string]string{
+			_kerberosCredentialCachePathConfig:     c.KerberosCredentialCachePath,
+			_kerberosRemoteServiceNameConfig:       c.KerberosRemoteServiceName,
+			_kerberosServicePrincipalPatternConfig: c.KerberosServicePrincipalPattern,
+			_kerberosUseCanonicalHostnameConfig:    c.KerberosUseCanonicalHostname,
+		} {
+			if v != "" {
+				query.Add(k, v)
+			}
+		}
 		if !isSSL {
 			return "", fmt.Errorf("trino: client configuration error, SSL must be enabled for secure env")
 		}
@@ -65,11 +97,53 @@ func (c *Config) FormatDSN() (string, error) {
 		"schema":             c.Schema,
 		"session_properties": strings.Join(sessionkv, ","),
 		"custom_client":      c.CustomClientName,
+		"client_tags":        strings.Join(c.ClientTags, ","),
+		"client_info":        c.ClientInfo,
+		"trace_token":        c.TraceToken,
+		"roles":              formatKeyValueList(c.Roles),
+		"extra_credentials":  formatKeyValueList(c.ExtraCredentials),
+		"time_zone":          c.TimeZone,
+		"language":           c.Language,
+		"path":               c.Path,
+		"resource_estimates": formatKeyValueList(c.ResourceEstimates),
+		"warnings_as_errors": strings.Join(c.WarningsAsErrors, ","),
+		"ping_query":         c.PingQuery,
+		"encoding":           strings.Join(c.Encoding, ","),
+		"hosts":              strings.Join(c.Hosts, ","),
+		"host_selection":     c.HostSelection,
+		"debug":              c.Debug,
 	} {
 		if v != "" {
 			query[k] = []string{v}
 		}
 	}
+	if c.RewriteURIs {
+		query.Set("rewrite_uris", "true")
+	}
+	if c.SpoolingWorkers > 0 {
+		query.Set("spooling_workers", strconv.Itoa(c.SpoolingWorkers))
+	}
+	if c.PrefetchPages > 0 {
+		query.Set("prefetch_pages", strconv.Itoa(c.PrefetchPages))
+	}
 	serverURL.RawQuery = query.Encode()
 	return serverURL.String(), nil
 }
+
+// String returns the DSN of the configuration with its secrets redacted:
+// the password of ServerURI and the values of ExtraCredentials.
+func (c Config) String() string {
+	c.ServerURI = redactURI(c.ServerURI)
+	if len(c.ExtraCredentials) > 0 {
+		creds := make(map[string]string, len(c.ExtraCredentials))
+		for k := range c.ExtraCredentials {
+			creds[k] = redacted
+		}
+		c.ExtraCredentials = creds
+	}
+	dsn, err := c.FormatDSN()
+	if err != nil {
+		return c.ServerURI
+	}
+	return dsn
+}
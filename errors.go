@@ -35,6 +35,19 @@ func (e *ErrQueryFailed) Error() string {
 		e.StatusCode, http.StatusText(e.StatusCode), e.Reason)
 }
 
+// ErrQueryWarning indicates that a query raised a warning configured to be
+// treated as an error, see WithWarningsAsErrors.
+type ErrQueryWarning struct {
+	QueryID string
+	Warning Warning
+}
+
+// Error implements the error interface.
+func (e *ErrQueryWarning) Error() string {
+	return fmt.Sprintf("trino: query %s raised warning %s: %s",
+		e.QueryID, e.Warning.Code.Name, e.Warning.Message)
+}
+
 func newErrQueryFailedFromResponse(resp *http.Response) *ErrQueryFailed {
 	const maxBytes = 8 * 1024
 	defer resp.Body.Close()
@@ -0,0 +1,118 @@
+package trino
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// dsnClientHeaders maps the DSN parameters to the client headers they set.
+var dsnClientHeaders = map[string]string{
+	"client_tags":        "clientTags",
+	"client_info":        "clientInfo",
+	"trace_token":        "traceToken",
+	"roles":              "role",
+	"extra_credentials":  "extraCredential",
+	"time_zone":          "timeZone",
+	"language":           "language",
+	"path":               "path",
+	"resource_estimates": "resourceEstimate",
+}
+
+// namedArgClientHeaders maps the per-query named arguments to the client
+// headers they override.
+var namedArgClientHeaders = map[string]string{
+	ClientTagsHeader:        "clientTags",
+	ClientInfoHeader:        "clientInfo",
+	TraceTokenHeader:        "traceToken",
+	RolesHeader:             "role",
+	ExtraCredentialsHeader:  "extraCredential",
+	TimeZoneHeader:          "timeZone",
+	LanguageHeader:          "language",
+	PathHeader:              "path",
+	ResourceEstimatesHeader: "resourceEstimate",
+}
+
+// setClientHeader replaces the client header identified by key (see vhs)
+// in hs with value, formatted the way Trino expects it. Roles, extra
+// credentials and resource estimates are given as a comma-separated list
+// of key=value pairs and sent as one header per pair.
+func setClientHeader(hs http.Header, key, value string) error {
+	name := vhs[v][key]
+	hs.Del(name)
+	if value == "" {
+		return nil
+	}
+	switch key {
+	case "clientTags":
+		hs.Set(name, strings.Join(splitList(value), ","))
+	case "role", "extraCredential", "resourceEstimate":
+		kvs, err := parseKeyValueList(value)
+		if err != nil {
+			return fmt.Errorf("trino: invalid %s: %v", name, err)
+		}
+		for _, k := range sortedKeys(kvs) {
+			val := kvs[k]
+			if key == "role" {
+				val = formatRole(val)
+			}
+			hs.Add(name, k+"="+url.QueryEscape(val))
+		}
+	default:
+		hs.Set(name, value)
+	}
+	return nil
+}
+
+// formatRole returns the selected role the way Trino serializes it.
+func formatRole(role string) string {
+	switch strings.ToUpper(role) {
+	case "ALL", "NONE":
+		return strings.ToUpper(role)
+	}
+	return "ROLE{" + role + "}"
+}
+
+// splitList splits a comma-separated list, dropping empty elements.
+func splitList(s string) []string {
+	var list []string
+	for _, e := range strings.Split(s, ",") {
+		if e = strings.TrimSpace(e); e != "" {
+			list = append(list, e)
+		}
+	}
+	return list
+}
+
+// parseKeyValueList parses a comma-separated list of key=value pairs.
+func parseKeyValueList(s string) (map[string]string, error) {
+	kvs := make(map[string]string)
+	for _, e := range splitList(s) {
+		kv := strings.SplitN(e, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, fmt.Errorf("malformed key=value pair %q", e)
+		}
+		kvs[kv[0]] = kv[1]
+	}
+	return kvs, nil
+}
+
+// formatKeyValueList is the inverse of parseKeyValueList, with keys sorted.
+func formatKeyValueList(kvs map[string]string) string {
+	list := make([]string, 0, len(kvs))
+	for _, k := range sortedKeys(kvs) {
+		list = append(list, k+"="+kvs[k])
+	}
+	return strings.Join(list, ",")
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,280 @@
+package trino
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultHostRetryDelay is how long a coordinator that couldn't be reached
+// is skipped by the queries submitted to the connections with several
+// hosts, unless all the other ones are unreachable too.
+var DefaultHostRetryDelay = 30 * time.Second
+
+// maxSubmitRedirects is the number of 307 and 308 redirects followed when
+// submitting a query, e.g. by a Trino Gateway.
+const maxSubmitRedirects = 5
+
+// Host selection policies, set with the host_selection DSN parameter.
+const (
+	// HostSelectionPriority submits the queries to the first reachable host,
+	// in the order of the DSN: the host of the DSN, then the hosts
+	// parameter.
+	HostSelectionPriority = "priority"
+	// HostSelectionRoundRobin spreads the queries over the reachable hosts.
+	HostSelectionRoundRobin = "round_robin"
+)
+
+// hostPool keeps track of the coordinators that can be reached, for all the
+// connections to the same hosts.
+type hostPool struct {
+	hosts      []string // base URLs, e.g. https://host:8443
+	roundRobin bool
+	next       uint32
+
+	mu   sync.Mutex
+	down map[string]time.Time // when unreachable hosts can be tried again
+}
+
+var hostPoolRegistry = struct {
+	sync.Mutex
+	Index map[string]*hostPool
+}{
+	Index: make(map[string]*hostPool),
+}
+
+// getHostPool returns the pool shared by the connections with the host of
+// serverURL and the hosts DSN parameter.
+func getHostPool(serverURL *url.URL, hosts, selection string) (*hostPool, error) {
+	var roundRobin bool
+	switch selection {
+	case "", HostSelectionPriority:
+	case HostSelectionRoundRobin:
+		roundRobin = true
+	default:
+		return nil, fmt.Errorf("trino: invalid host_selection: %q", selection)
+	}
+	baseURLs := []string{serverURL.Scheme + "://" + serverURL.Host}
+	for _, host := range splitList(hosts) {
+		if strings.Contains(host, "/") {
+			return nil, fmt.Errorf("trino: invalid host in hosts: %q", host)
+		}
+		baseURLs = append(baseURLs, serverURL.Scheme+"://"+host)
+	}
+	key := strings.Join(baseURLs, ",")
+	if roundRobin {
+		key += "|" + HostSelectionRoundRobin
+	}
+
+	hostPoolRegistry.Lock()
+	defer hostPoolRegistry.Unlock()
+	if p, ok := hostPoolRegistry.Index[key]; ok {
+		return p, nil
+	}
+	p := &hostPool{
+		hosts:      baseURLs,
+		roundRobin: roundRobin,
+		down:       make(map[string]time.Time),
+	}
+	hostPoolRegistry.Index[key] = p
+	return p, nil
+}
+
+// candidates returns the hosts to submit a query to, in order: the
+// reachable ones according to the selection policy, then the others as a
+// last resort.
+func (p *hostPool) candidates() []string {
+	start := 0
+	if p.roundRobin {
+		start = int((atomic.AddUint32(&p.next, 1) - 1) % uint32(len(p.hosts)))
+	}
+	return p.order(start)
+}
+
+// order returns the hosts starting from start, reachable ones first.
+func (p *hostPool) order(start int) []string {
+	now := time.Now()
+	up := make([]string, 0, len(p.hosts))
+	var down []string
+	p.mu.Lock()
+	for i := range p.hosts {
+		host := p.hosts[(start+i)%len(p.hosts)]
+		if until, ok := p.down[host]; ok && now.Before(until) {
+			down = append(down, host)
+			continue
+		}
+		up = append(up, host)
+	}
+	p.mu.Unlock()
+	return append(up, down...)
+}
+
+// checkDue reports whether host, skipped since it was found down, is due to
+// be checked before queries are sent to it again. The next check is then
+// postponed, so that a single query checks it while the others keep
+// skipping it.
+func (p *hostPool) checkDue(host string) bool {
+	if len(p.hosts) == 1 {
+		return false
+	}
+	now := time.Now()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	until, ok := p.down[host]
+	if !ok || now.Before(until) {
+		return false
+	}
+	p.down[host] = now.Add(DefaultHostRetryDelay)
+	return true
+}
+
+func (p *hostPool) markDown(host string) {
+	p.mu.Lock()
+	p.down[host] = time.Now().Add(DefaultHostRetryDelay)
+	p.mu.Unlock()
+}
+
+func (p *hostPool) markUp(host string) {
+	p.mu.Lock()
+	delete(p.down, host)
+	p.mu.Unlock()
+}
+
+// submitHostKey is the context key of the base URL of the only host a query
+// is submitted to, e.g. to kill a query on the coordinator running it.
+type submitHostKey struct{}
+
+// submitQuery posts query to the coordinators until one accepts it, and
+// returns its response and the base URL of that coordinator, to which the
+// query is bound from then on. Other hosts are only tried when a host
+// can't be connected to, as the query can't have been accepted by it, or
+// when a host that was down fails its health check.
+func (c *Conn) submitQuery(ctx context.Context, query string, hs http.Header) (*Response, string, error) {
+	hosts := c.hosts.candidates()
+	if host, ok := ctx.Value(submitHostKey{}).(string); ok {
+		hosts = []string{host}
+	}
+	bad := atomic.LoadInt32(&c.bad)
+	var err error
+	for i, host := range hosts {
+		if c.hosts.checkDue(host) {
+			if err = c.checkHost(ctx, host); err != nil {
+				if ctx.Err() != nil {
+					return nil, "", err
+				}
+				c.hosts.markDown(host)
+				continue
+			}
+		}
+		var resp *Response
+		var server string
+		resp, server, err = c.post(ctx, host+"/v1/statement", query, hs)
+		if err == nil {
+			c.hosts.markUp(host)
+			if i > 0 {
+				// the hosts that failed don't make this connection bad
+				atomic.StoreInt32(&c.bad, bad)
+			}
+			return resp, server, nil
+		}
+		if !isDialError(err) || ctx.Err() != nil {
+			return nil, "", err
+		}
+		c.hosts.markDown(host)
+	}
+	return nil, "", err
+}
+
+// checkHost checks that host can be sent queries: that it can be connected
+// to and, when it answers /v1/info, that it's done starting. Unlike Ping, it
+// doesn't run the ping query, which would be submitted to the hosts.
+func (c *Conn) checkHost(ctx context.Context, host string) error {
+	req, err := c.newRequest("GET", host+"/v1/info", nil, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.do(ctx, &Request{Request: req.WithContext(ctx), Phase: PhaseInfo})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	var info serverInfo
+	if resp.StatusCode == http.StatusOK && json.NewDecoder(resp.Body).Decode(&info) == nil && info.Starting {
+		return &ErrQueryFailed{StatusCode: resp.StatusCode, Reason: errors.New("coordinator starting")}
+	}
+	return nil
+}
+
+// post posts query to uri, following 307 and 308 redirects with the same
+// headers, which the HTTP client would drop when redirected to another
+// host. Redirects are only followed to the hosts of the connection, see
+// checkRedirect. It returns the base URL of the server that answered.
+func (c *Conn) post(ctx context.Context, uri, query string, hs http.Header) (*Response, string, error) {
+	for redirects := 0; ; redirects++ {
+		req, err := c.newRequest("POST", uri, strings.NewReader(query), hs)
+		if err != nil {
+			return nil, "", err
+		}
+		resp, err := c.roundTrip(ctx, &Request{Request: req, Phase: PhaseSubmit})
+		if err != nil {
+			return nil, "", err
+		}
+		if resp.StatusCode != http.StatusTemporaryRedirect && resp.StatusCode != http.StatusPermanentRedirect {
+			return resp, req.URL.Scheme + "://" + req.URL.Host, nil
+		}
+		location, err := resp.Location()
+		io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, "", &ErrQueryFailed{StatusCode: resp.StatusCode, Reason: err}
+		}
+		if redirects == maxSubmitRedirects {
+			return nil, "", &ErrQueryFailed{
+				StatusCode: resp.StatusCode,
+				Reason:     fmt.Errorf("stopped after %d redirects", maxSubmitRedirects),
+			}
+		}
+		if err := c.checkRedirect(req.URL, location); err != nil {
+			return nil, "", &ErrQueryFailed{StatusCode: resp.StatusCode, Reason: err}
+		}
+		uri = location.String()
+	}
+}
+
+// checkRedirect checks that a submission can follow a redirect from uri to
+// location, which is sent the credentials of the connection: only to the
+// same origin or to one of the hosts, and never from https to http.
+func (c *Conn) checkRedirect(uri, location *url.URL) error {
+	if uri.Scheme == "https" && location.Scheme != "https" {
+		return fmt.Errorf("refusing redirect from https to %s", location.Scheme)
+	}
+	target := location.Scheme + "://" + location.Host
+	if strings.EqualFold(target, uri.Scheme+"://"+uri.Host) {
+		return nil
+	}
+	for _, host := range c.hosts.hosts {
+		if strings.EqualFold(target, host) {
+			return nil
+		}
+	}
+	return fmt.Errorf("refusing redirect to %s, which is not one of the hosts of the DSN", target)
+}
+
+// isDialError reports whether err is the failure to connect to a host.
+func isDialError(err error) bool {
+	if qf, ok := err.(*ErrQueryFailed); ok {
+		err = qf.Reason
+	}
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
@@ -0,0 +1,308 @@
+package trino
+
+import (
+	"bytes"
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// Phase is the part of the lifecycle of a query a request to the
+// coordinator belongs to.
+type Phase string
+
+const (
+	PhaseSubmit Phase = "submit" // POST /v1/statement, or the location it's redirected to
+	PhasePoll   Phase = "poll"   // GET of the nextUri of a query
+	PhaseCancel Phase = "cancel" // DELETE of the nextUri, partialCancelUri or /v1/query/{id}
+	PhaseInfo   Phase = "info"   // GET /v1/info when pinging or checking the coordinator, or /v1/query/{id}
+)
+
+// Request is a request to the coordinator, as seen by interceptors.
+type Request struct {
+	*http.Request
+	Phase   Phase
+	QueryID string // empty when submitting a query
+
+	retries int // attempts retried by the built-in interceptors
+}
+
+// Response is a response of the coordinator, as seen by interceptors.
+type Response struct {
+	*http.Response
+
+	// Metadata is decoded from the successful responses to the submit and
+	// poll phases when the connection has interceptors or debug logs, and
+	// nil otherwise. An interceptor replacing a response can leave it nil,
+	// the driver decodes the body instead.
+	Metadata *ResponseMetadata
+
+	decoded *queryResponse // the body of the response, when decoded
+	size    int64          // of the body, when decoded
+}
+
+// ResponseMetadata describes the state of a query, as reported by a response
+// to a submit or poll request. The URIs are the ones advertised by the
+// coordinator, before they are rewritten.
+type ResponseMetadata struct {
+	QueryID    string
+	InfoURI    string
+	NextURI    string
+	Stats      QueryStats
+	Warnings   []Warning
+	UpdateType string
+	// Error is the error of the query when it failed, as it is returned to
+	// the caller: an *ErrQueryFailed, or ErrQueryCancelled.
+	Error error
+}
+
+// RoundTripFunc sends a request to the coordinator and returns its
+// response. It returns an error when no response is received; responses
+// with an error status are returned as they are.
+type RoundTripFunc func(ctx context.Context, req *Request) (*Response, error)
+
+// Interceptor wraps the sending of the requests to the coordinator, to log,
+// audit, sign them, add headers or inject faults. It is set for the
+// connections of a Connector:
+//
+//	connector.Interceptors = []trino.Interceptor{
+//		func(next trino.RoundTripFunc) trino.RoundTripFunc {
+//			return func(ctx context.Context, req *trino.Request) (*trino.Response, error) {
+//				start := time.Now()
+//				resp, err := next(ctx, req)
+//				log.Printf("%s %s %s: %v", req.Phase, req.QueryID, time.Since(start), err)
+//				return resp, err
+//			}
+//		},
+//	}
+//
+// The interceptors wrap each other in order, the first one seeing the
+// requests first, and run inside the built-in retries, debug logs and
+// metrics, and outside the built-in authentication: they see every attempt
+// of a request retried after a 503, before the Basic or Kerberos
+// authentication headers are set. The debug logs are written around the
+// interceptors: they show every attempt with the response or error the
+// interceptors returned for it. An interceptor that doesn't return the
+// response of next must close its body.
+type Interceptor func(next RoundTripFunc) RoundTripFunc
+
+// buildChain returns the chain of the built-in interceptors around the
+// given ones.
+func (c *Conn) buildChain(interceptors []Interceptor) RoundTripFunc {
+	chain := []Interceptor{c.retryInterceptor, c.loggingInterceptor, c.metricsInterceptor}
+	chain = append(chain, interceptors...)
+	chain = append(chain, c.authInterceptor)
+	c.intercepted = len(interceptors) > 0
+	rt := RoundTripFunc(c.send)
+	for i := len(chain) - 1; i >= 0; i-- {
+		rt = chain[i](rt)
+	}
+	return rt
+}
+
+// do sends req through the chain of interceptors.
+func (c *Conn) do(ctx context.Context, req *Request) (*Response, error) {
+	span := spanFromContext(ctx)
+	if span != nil {
+		if traceParent := span.TraceParent(); traceParent != "" {
+			req.Header.Set(_traceParentHeader, traceParent)
+		}
+	}
+	resp, err := c.chain(ctx, req)
+	if span != nil && req.retries > 0 {
+		span.SetAttributes(Attribute{AttrRetries, int64(req.retries)})
+	}
+	return resp, err
+}
+
+// roundTrip sends a request submitting a query or polling its results, and
+// returns an error for the responses with an error status, except the
+// redirects of submit requests.
+func (c *Conn) roundTrip(ctx context.Context, req *Request) (*Response, error) {
+	resp, err := c.do(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return resp, nil
+	case http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		if req.Phase == PhaseSubmit {
+			return resp, nil
+		}
+	}
+	return nil, newErrQueryFailedFromResponse(resp.Response)
+}
+
+// send is the end of the chain, sending the request with the HTTP client of
+// the connection. It decodes the metadata of the successful responses to
+// submit and poll requests when interceptors or debug logs need it;
+// otherwise the driver decodes the body as it is read.
+func (c *Conn) send(ctx context.Context, req *Request) (*Response, error) {
+	timeout := DefaultQueryTimeout
+	if deadline, ok := ctx.Deadline(); ok {
+		timeout = deadline.Sub(time.Now())
+	}
+	client := c.httpClient
+	client.Timeout = timeout
+	if req.Phase == PhaseSubmit {
+		// redirects are followed by Conn.post
+		client.CheckRedirect = func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		}
+	}
+	resp, err := client.Do(req.Request)
+	if err != nil {
+		if (req.Phase == PhaseSubmit || req.Phase == PhasePoll) && ctx.Err() == nil {
+			atomic.StoreInt32(&c.bad, 1)
+		}
+		return nil, &ErrQueryFailed{Reason: err}
+	}
+	r := &Response{Response: resp}
+	if resp.StatusCode != http.StatusOK || (req.Phase != PhaseSubmit && req.Phase != PhasePoll) || !c.needsMetadata() {
+		return r, nil
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, &ErrQueryFailed{StatusCode: resp.StatusCode, Reason: err}
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	qresp, err := readQueryResponse(bytes.NewReader(body), nil, nil)
+	if err != nil {
+		// left to the caller, which reports the error
+		return r, nil
+	}
+	r.decoded = qresp
+	r.size = int64(len(body))
+	r.Metadata = &ResponseMetadata{
+		QueryID:    qresp.ID,
+		InfoURI:    qresp.InfoURI,
+		NextURI:    qresp.NextURI,
+		Stats:      qresp.Stats,
+		Warnings:   qresp.Warnings,
+		UpdateType: qresp.UpdateType,
+		Error:      handleResponseError(resp.StatusCode, qresp.Error),
+	}
+	return r, nil
+}
+
+// needsMetadata reports whether the responses must be decoded for the
+// interceptors or the debug logs to see their metadata.
+func (c *Conn) needsMetadata() bool {
+	return c.intercepted || (c.logger != nil && c.debug != debugOff)
+}
+
+// queryResponse returns the decoded body of a successful response to a
+// submit or poll request, and its size. The rows of its data are decoded
+// with coltype and appended to values, see readQueryResponse.
+func (r *Response) queryResponse(coltype []*typeConverter, values []driver.Value) (*queryResponse, int64, error) {
+	if r.decoded != nil {
+		return r.decoded, r.size, nil
+	}
+	defer r.Body.Close()
+	body := &countingReader{ReadCloser: r.Body}
+	qresp, err := readQueryResponse(body, coltype, values)
+	return qresp, body.n, err
+}
+
+// retryInterceptor retries the submit and poll requests while the
+// coordinator answers 503, with an exponential backoff.
+func (c *Conn) retryInterceptor(next RoundTripFunc) RoundTripFunc {
+	return func(ctx context.Context, req *Request) (*Response, error) {
+		if req.Phase != PhaseSubmit && req.Phase != PhasePoll {
+			return next(ctx, req)
+		}
+		delay := 100 * time.Millisecond
+		const maxDelayBetweenRequests = float64(15 * time.Second)
+		timer := time.NewTimer(0)
+		defer timer.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-timer.C:
+			}
+			resp, err := next(ctx, req)
+			if err != nil || resp.StatusCode != http.StatusServiceUnavailable {
+				return resp, err
+			}
+			resp.Body.Close()
+			if !rewindBody(req.Request) {
+				return nil, &ErrQueryFailed{StatusCode: resp.StatusCode, Reason: fmt.Errorf("cannot retry request: http status is %s", resp.Status)}
+			}
+			req.retries++
+			timer.Reset(delay)
+			delay = time.Duration(math.Min(
+				float64(delay)*math.Phi,
+				maxDelayBetweenRequests,
+			))
+		}
+	}
+}
+
+// metricsInterceptor reports the responses to the submit and poll requests
+// to the Metrics of the query.
+func (c *Conn) metricsInterceptor(next RoundTripFunc) RoundTripFunc {
+	return func(ctx context.Context, req *Request) (*Response, error) {
+		resp, err := next(ctx, req)
+		if m := queryMetricsFromContext(ctx); m != nil && err == nil && (req.Phase == PhaseSubmit || req.Phase == PhasePoll) {
+			m.metrics.HTTPResponse(m.labels, resp.StatusCode, resp.StatusCode == http.StatusServiceUnavailable)
+		}
+		return resp, err
+	}
+}
+
+// authInterceptor sets the Basic or Kerberos authentication headers, and
+// renews the Kerberos ticket once when the coordinator rejects it. A
+// connection whose credentials are rejected is reported bad, so that
+// database/sql discards it.
+func (c *Conn) authInterceptor(next RoundTripFunc) RoundTripFunc {
+	return func(ctx context.Context, req *Request) (*Response, error) {
+		if c.kerberosEnabled {
+			if err := c.kerberosClient.setSPNEGOHeader(req.Request, c.kerberosSPN(req.URL.Hostname())); err != nil {
+				return nil, err
+			}
+		}
+		if c.auth != nil {
+			pass, _ := c.auth.Password()
+			req.SetBasicAuth(c.auth.Username(), pass)
+		}
+		resp, err := next(ctx, req)
+		if err != nil || resp.StatusCode != http.StatusUnauthorized {
+			return resp, err
+		}
+		if c.renewKerberosAuth(req.Request, resp.Response) {
+			resp.Body.Close()
+			req.retries++
+			resp, err = next(ctx, req)
+			if err != nil || resp.StatusCode != http.StatusUnauthorized {
+				return resp, err
+			}
+		}
+		atomic.StoreInt32(&c.bad, 1)
+		return resp, nil
+	}
+}
+
+// rewindBody resets the body of req to send it again. It reports whether
+// req can be sent again.
+func rewindBody(req *http.Request) bool {
+	if req.Body == nil || req.Body == http.NoBody {
+		return true
+	}
+	if req.GetBody == nil {
+		return false
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return false
+	}
+	req.Body = body
+	return true
+}
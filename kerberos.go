@@ -0,0 +1,209 @@
+package trino
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/jcmturner/gokrb5.v6/client"
+	"gopkg.in/jcmturner/gokrb5.v6/config"
+	"gopkg.in/jcmturner/gokrb5.v6/credentials"
+	"gopkg.in/jcmturner/gokrb5.v6/keytab"
+	"gopkg.in/jcmturner/gokrb5.v6/messages"
+)
+
+const (
+	// DefaultKerberosRemoteServiceName is the service part of the principal
+	// Trino coordinators are usually registered with.
+	DefaultKerberosRemoteServiceName = "presto"
+
+	// DefaultKerberosServicePrincipalPattern builds the service principal
+	// from the remote service name and the coordinator hostname.
+	DefaultKerberosServicePrincipalPattern = "${SERVICE}/${HOST}"
+)
+
+// kerberosRenewMargin is how long before the ticket expiry a new login is made.
+var kerberosRenewMargin = 5 * time.Minute
+
+// registry for logged-in Kerberos clients, shared by all connections using
+// the same credentials.
+var kerberosClientRegistry = struct {
+	sync.Mutex
+	Index map[kerberosCredentials]*kerberosClient
+}{
+	Index: make(map[kerberosCredentials]*kerberosClient),
+}
+
+// kerberosCredentials identifies where and how a Kerberos client logs in.
+type kerberosCredentials struct {
+	principal  string
+	realm      string
+	keytabPath string
+	ccachePath string
+	configPath string
+}
+
+// kerberosClient wraps a gokrb5 client and logs in again when the ticket
+// expires or the coordinator rejects it.
+type kerberosClient struct {
+	mu     sync.Mutex
+	creds  kerberosCredentials
+	client *client.Client
+	expiry time.Time // zero when unknown
+}
+
+// getKerberosClient returns the logged-in client for the credentials,
+// logging in on first use.
+func getKerberosClient(creds kerberosCredentials) (*kerberosClient, error) {
+	kerberosClientRegistry.Lock()
+	defer kerberosClientRegistry.Unlock()
+	if kc, ok := kerberosClientRegistry.Index[creds]; ok {
+		return kc, nil
+	}
+	kc := &kerberosClient{creds: creds}
+	if err := kc.login(); err != nil {
+		return nil, err
+	}
+	kerberosClientRegistry.Index[creds] = kc
+	return kc, nil
+}
+
+// login creates a new gokrb5 client from the keytab or credential cache.
+// The files are read again on every login so that a credential cache
+// refreshed by kinit is picked up. Must be called with mu held or before
+// the client is shared.
+func (kc *kerberosClient) login() error {
+	conf, err := config.Load(kc.creds.configPath)
+	if err != nil {
+		return fmt.Errorf("trino: Error loading krb config: %v", err)
+	}
+
+	var cl client.Client
+	var expiry time.Time
+	if kc.creds.ccachePath != "" {
+		cc, err := credentials.LoadCCache(kc.creds.ccachePath)
+		if err != nil {
+			return fmt.Errorf("trino: Error loading credential cache: %v", err)
+		}
+		cl, err = client.NewClientFromCCache(cc)
+		if err != nil {
+			return fmt.Errorf("trino: Error loading credential cache: %v", err)
+		}
+		cl.WithConfig(conf)
+		for _, cred := range cc.Credentials {
+			if name := cred.Server.PrincipalName.NameString; len(name) > 0 && name[0] == "krbtgt" {
+				expiry = cred.EndTime
+				break
+			}
+		}
+		if !expiry.IsZero() && time.Now().After(expiry) {
+			return fmt.Errorf("trino: Kerberos credential cache %q has expired", kc.creds.ccachePath)
+		}
+	} else {
+		kt, err := keytab.Load(kc.creds.keytabPath)
+		if err != nil {
+			return fmt.Errorf("trino: Error loading Keytab: %v", err)
+		}
+		cl = client.NewClientWithKeytab(kc.creds.principal, kc.creds.realm, kt)
+		cl.WithConfig(conf)
+		if expiry, err = keytabLogin(&cl); err != nil {
+			return fmt.Errorf("trino: Error login to KDC: %v", err)
+		}
+	}
+
+	if kc.client != nil {
+		kc.client.Destroy()
+	}
+	kc.client = &cl
+	kc.expiry = expiry
+	return nil
+}
+
+// keytabLogin gets a TGT like client.Login does and returns its end time,
+// which gokrb5 doesn't expose.
+func keytabLogin(cl *client.Client) (time.Time, error) {
+	if ok, err := cl.IsConfigured(); !ok {
+		return time.Time{}, err
+	}
+	req, err := messages.NewASReqForTGT(cl.Credentials.Realm, cl.Config, cl.Credentials.CName)
+	if err != nil {
+		return time.Time{}, err
+	}
+	// ASExchange adds the pre-authentication data when the KDC requires it
+	rep, err := cl.ASExchange(cl.Credentials.Realm, req, 0)
+	if err != nil {
+		return time.Time{}, err
+	}
+	cl.AddSession(rep.Ticket, rep.DecryptedEncPart)
+	return rep.DecryptedEncPart.EndTime, nil
+}
+
+// relogin discards the current tickets and logs in again.
+func (kc *kerberosClient) relogin() error {
+	kc.mu.Lock()
+	defer kc.mu.Unlock()
+	return kc.login()
+}
+
+// setSPNEGOHeader sets the Authorization header of req for the given
+// service principal, logging in again if the ticket is about to expire or
+// cannot be obtained.
+func (kc *kerberosClient) setSPNEGOHeader(req *http.Request, spn string) error {
+	kc.mu.Lock()
+	defer kc.mu.Unlock()
+	if !kc.expiry.IsZero() && time.Now().Add(kerberosRenewMargin).After(kc.expiry) {
+		if err := kc.login(); err != nil {
+			return err
+		}
+	}
+	err := kc.client.SetSPNEGOHeader(req, spn)
+	if err == nil {
+		return nil
+	}
+	if loginErr := kc.login(); loginErr != nil {
+		return fmt.Errorf("error setting client SPNEGO header: %v", err)
+	}
+	if err = kc.client.SetSPNEGOHeader(req, spn); err != nil {
+		return fmt.Errorf("error setting client SPNEGO header: %v", err)
+	}
+	return nil
+}
+
+// kerberosServicePrincipal builds the service principal of the coordinator
+// at host from the pattern, e.g. "${SERVICE}/${HOST}". The GSS host-based
+// form of the Java client, "${SERVICE}@${HOST}", is turned into the
+// service/host form, as gokrb5 would take the host for the realm.
+func kerberosServicePrincipal(pattern, service, host string, canonical bool) string {
+	if canonical {
+		host = canonicalHostname(host)
+	}
+	spn := strings.NewReplacer("${SERVICE}", service, "${HOST}", strings.ToLower(host)).Replace(pattern)
+	if !strings.Contains(spn, "/") {
+		spn = strings.Replace(spn, "@", "/", 1)
+	}
+	return spn
+}
+
+// lookupHost and lookupAddr resolve the names of coordinators, replaced in
+// tests.
+var (
+	lookupHost = net.LookupHost
+	lookupAddr = net.LookupAddr
+)
+
+// canonicalHostname resolves host to its fully qualified name, the same way
+// the Java client does. The host is returned unchanged if it can't be resolved.
+func canonicalHostname(host string) string {
+	addrs, err := lookupHost(host)
+	if err != nil || len(addrs) == 0 {
+		return host
+	}
+	names, err := lookupAddr(addrs[0])
+	if err != nil || len(names) == 0 {
+		return host
+	}
+	return strings.TrimSuffix(names[0], ".")
+}
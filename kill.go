@@ -0,0 +1,120 @@
+package trino
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+var _queryIDPattern = regexp.MustCompile(`^[a-z0-9_]+$`)
+
+// KillQuery kills the query with the given ID, failing it with reason, from
+// any connection of db, e.g. to stop a query found in a dashboard. It
+// reports whether the query was running. The user of the connection must
+// be allowed to kill the query by the access control of the cluster.
+//
+// The query is killed with CALL system.runtime.kill_query, falling back to
+// DELETE /v1/query/{id} when the procedure or the system catalog doesn't
+// exist, in which case the reason is not recorded. With several hosts, the
+// query is looked for on each of them. Other errors, such as the access
+// control denying the kill, are returned.
+func KillQuery(ctx context.Context, db *sql.DB, queryID, reason string) (bool, error) {
+	if !_queryIDPattern.MatchString(queryID) {
+		return false, fmt.Errorf("trino: invalid query ID: %q", queryID)
+	}
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+	var killed bool
+	err = conn.Raw(func(driverConn interface{}) error {
+		c, ok := driverConn.(*Conn)
+		if !ok {
+			return fmt.Errorf("trino: KillQuery needs a Trino database, got a %T connection", driverConn)
+		}
+		killed, err = c.killQuery(ctx, queryID, reason)
+		return err
+	})
+	return killed, err
+}
+
+func (c *Conn) killQuery(ctx context.Context, queryID, reason string) (bool, error) {
+	message := "NULL"
+	if reason != "" {
+		var err error
+		if message, err = Serial(reason); err != nil {
+			return false, err
+		}
+	}
+	st := &driverStmt{
+		conn:  c,
+		query: "CALL system.runtime.kill_query(query_id => '" + queryID + "', message => " + message + ")",
+	}
+	// the query is only known to the coordinator running it, so the
+	// procedure is called on every host until one finds it
+	var unreachable error
+	for _, host := range c.hosts.order(0) {
+		_, err := st.ExecContext(context.WithValue(ctx, submitHostKey{}, host), nil)
+		if err == nil {
+			return true, nil
+		}
+		if isDialError(err) && ctx.Err() == nil {
+			unreachable = err
+			continue
+		}
+		qf, ok := err.(*ErrQueryFailed)
+		if !ok {
+			return false, err
+		}
+		se, ok := qf.Reason.(*stmtError)
+		if !ok {
+			// the coordinator rejected the request
+			return false, err
+		}
+		switch {
+		case se.ErrorName == "NOT_FOUND":
+			continue
+		case strings.HasPrefix(se.Message, "Target query is not running"):
+			return false, nil
+		case se.ErrorName == "PROCEDURE_NOT_FOUND" || se.ErrorName == "CATALOG_NOT_FOUND":
+			return c.deleteQuery(ctx, queryID)
+		}
+		return false, err
+	}
+	return false, unreachable
+}
+
+// deleteQuery cancels a query with DELETE /v1/query/{id}, which succeeds
+// whether the query is running or not, so its status is checked first. The
+// query is looked for on every host, as it may run on any of them.
+func (c *Conn) deleteQuery(ctx context.Context, queryID string) (bool, error) {
+	// the error of a host that couldn't be reached, and may run the query
+	var unreachable error
+	for _, server := range c.hosts.order(0) {
+		status, err := (&Client{conn: c}).Status(ctx, &QueryHandle{QueryID: queryID, Server: server})
+		if err != nil {
+			if qf, ok := err.(*ErrQueryFailed); ok && (qf.StatusCode == http.StatusNotFound || qf.StatusCode == http.StatusGone) {
+				// unknown to this coordinator
+				continue
+			}
+			if isDialError(err) && ctx.Err() == nil {
+				unreachable = err
+				continue
+			}
+			return false, err
+		}
+		if status.Done {
+			return false, nil
+		}
+		canceller := newQueryCanceller(c, server, nil, queryID, "")
+		if err := canceller.delete(ctx, server+"/v1/query/"+queryID, false); err != nil {
+			return false, err
+		}
+		return true, nil
+	}
+	return false, unreachable
+}
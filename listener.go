@@ -0,0 +1,177 @@
+package trino
+
+// QueryListener is notified of the lifecycle of queries. It can be set for
+// all queries of a Connector, or for a single query with WithQueryListener.
+//
+// Methods are called synchronously from the goroutine running or iterating
+// the query, and should return quickly. Embed NopQueryListener to implement
+// only some of them.
+type QueryListener interface {
+	// OnSubmitted is called once Trino accepted the query.
+	OnSubmitted(queryID, infoURI string)
+
+	// OnStateChange is called when the query moves to a new state, such as
+	// QUEUED, RUNNING or FINISHED.
+	OnStateChange(queryID, oldState, newState string)
+
+	// OnProgress is called with the statistics of every response.
+	OnProgress(queryID string, stats QueryStats)
+
+	// OnWarning is called once for every warning raised by the query.
+	OnWarning(queryID string, warning Warning)
+
+	// OnCompleted is called when the last page of results of the query was
+	// received, before its rows are read.
+	OnCompleted(queryID string, finalStats QueryStats)
+
+	// OnFailed is called when the query failed, or with ErrQueryCancelled
+	// when it was cancelled by Trino, by closing its rows early or by
+	// reaching the limit set with WithMaxRows. The query ID is empty if the
+	// query couldn't be submitted.
+	OnFailed(queryID string, err error)
+}
+
+// NopQueryListener is a QueryListener that does nothing.
+type NopQueryListener struct{}
+
+var _ QueryListener = NopQueryListener{}
+
+func (NopQueryListener) OnSubmitted(queryID, infoURI string)               {}
+func (NopQueryListener) OnStateChange(queryID, oldState, newState string)  {}
+func (NopQueryListener) OnProgress(queryID string, stats QueryStats)       {}
+func (NopQueryListener) OnWarning(queryID string, warning Warning)         {}
+func (NopQueryListener) OnCompleted(queryID string, finalStats QueryStats) {}
+func (NopQueryListener) OnFailed(queryID string, err error)                {}
+
+// queryListeners notifies several listeners in order.
+type queryListeners []QueryListener
+
+func (ls queryListeners) OnSubmitted(queryID, infoURI string) {
+	for _, l := range ls {
+		l.OnSubmitted(queryID, infoURI)
+	}
+}
+
+func (ls queryListeners) OnStateChange(queryID, oldState, newState string) {
+	for _, l := range ls {
+		l.OnStateChange(queryID, oldState, newState)
+	}
+}
+
+func (ls queryListeners) OnProgress(queryID string, stats QueryStats) {
+	for _, l := range ls {
+		l.OnProgress(queryID, stats)
+	}
+}
+
+func (ls queryListeners) OnWarning(queryID string, warning Warning) {
+	for _, l := range ls {
+		l.OnWarning(queryID, warning)
+	}
+}
+
+func (ls queryListeners) OnCompleted(queryID string, finalStats QueryStats) {
+	for _, l := range ls {
+		l.OnCompleted(queryID, finalStats)
+	}
+}
+
+func (ls queryListeners) OnFailed(queryID string, err error) {
+	for _, l := range ls {
+		l.OnFailed(queryID, err)
+	}
+}
+
+// queryTracker turns the responses of a query into QueryListener events,
+// and collects the warnings of all of them.
+type queryTracker struct {
+	listener         QueryListener
+	warningsAsErrors map[string]bool
+	queryID          string
+	state            string
+	warnings         []Warning
+	seen             map[Warning]bool
+	done             bool
+	metrics          *queryMetrics // nil unless the connection has Metrics
+}
+
+// newQueryTracker returns the tracker of a query started with opts.
+func (c *Conn) newQueryTracker(opts queryOptions) *queryTracker {
+	var listeners queryListeners
+	for _, l := range []QueryListener{c.listener, opts.listener} {
+		if l != nil {
+			listeners = append(listeners, l)
+		}
+	}
+	tracker := &queryTracker{
+		listener:         listeners,
+		warningsAsErrors: make(map[string]bool),
+	}
+	// the slice of the connection is shared by concurrent queries, so it
+	// must not be appended to
+	for _, names := range [][]string{c.warningsAsErrors, opts.warningsAsErrors} {
+		for _, name := range names {
+			tracker.warningsAsErrors[name] = true
+		}
+	}
+	return tracker
+}
+
+// submitted reports that Trino accepted the query.
+func (t *queryTracker) submitted(queryID, infoURI string, stats QueryStats, warnings []Warning) error {
+	t.queryID = queryID
+	t.listener.OnSubmitted(queryID, infoURI)
+	return t.update(stats, warnings)
+}
+
+// update reports the state, progress and new warnings of a response. It
+// returns an *ErrQueryWarning for the first new warning whose name is
+// configured to be treated as an error.
+func (t *queryTracker) update(stats QueryStats, warnings []Warning) error {
+	if stats.State != "" && stats.State != t.state {
+		old := t.state
+		t.state = stats.State
+		t.listener.OnStateChange(t.queryID, old, stats.State)
+	}
+	t.listener.OnProgress(t.queryID, stats)
+	var err error
+	for _, w := range warnings {
+		if t.seen[w] {
+			continue
+		}
+		if t.seen == nil {
+			t.seen = make(map[Warning]bool)
+		}
+		t.seen[w] = true
+		t.warnings = append(t.warnings, w)
+		t.listener.OnWarning(t.queryID, w)
+		if err == nil && t.warningsAsErrors[w.Code.Name] {
+			err = &ErrQueryWarning{QueryID: t.queryID, Warning: w}
+		}
+	}
+	return err
+}
+
+// completed reports that the query finished, at most once.
+func (t *queryTracker) completed(stats QueryStats) {
+	if t.done {
+		return
+	}
+	t.done = true
+	t.listener.OnCompleted(t.queryID, stats)
+	if t.metrics != nil {
+		t.metrics.completed(stats)
+	}
+}
+
+// failed reports that the query failed, at most once.
+func (t *queryTracker) failed(err error) {
+	if t.done {
+		return
+	}
+	t.done = true
+	t.listener.OnFailed(t.queryID, err)
+	if t.metrics != nil {
+		t.metrics.failed(err)
+	}
+}
@@ -0,0 +1,197 @@
+package trino
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Logger receives the debug logs of the exchanges with the coordinator, as
+// alternating keys and values. It is implemented by *slog.Logger.
+type Logger interface {
+	DebugContext(ctx context.Context, msg string, args ...interface{})
+}
+
+// Debug levels, set with the debug DSN parameter.
+const (
+	// DebugRequests logs every request to the coordinator with its phase,
+	// method, URI, status, duration and the state of the query, and the
+	// number of rows of every page of results.
+	DebugRequests = "requests"
+	// DebugSQL also logs the SQL text of the queries and the headers of
+	// the requests.
+	DebugSQL = "sql"
+)
+
+// debugLevel is the level of the debug logs, the higher the more verbose.
+type debugLevel int
+
+const (
+	debugOff debugLevel = iota
+	debugRequests
+	debugSQL
+)
+
+func parseDebugLevel(s string) (debugLevel, error) {
+	switch strings.ToLower(s) {
+	case "", "false", "0":
+		return debugOff, nil
+	case DebugRequests, "true", "1":
+		return debugRequests, nil
+	case DebugSQL:
+		return debugSQL, nil
+	}
+	return debugOff, fmt.Errorf("trino: invalid debug: %q", s)
+}
+
+// stdLogger logs with the standard log package, for the connections with a
+// debug level and no Logger.
+type stdLogger struct{}
+
+func (stdLogger) DebugContext(ctx context.Context, msg string, args ...interface{}) {
+	var b strings.Builder
+	b.WriteString(msg)
+	for i := 0; i+1 < len(args); i += 2 {
+		fmt.Fprintf(&b, " %v=%q", args[i], fmt.Sprint(args[i+1]))
+	}
+	log.Print(b.String())
+}
+
+// redacted replaces secrets in logs and strings.
+const redacted = "xxxxx"
+
+// sensitiveParams are the DSN and URI query parameters whose values are
+// redacted.
+var sensitiveParams = []string{"password", "secret", "token", "credential"}
+
+// redactURI returns uri without its password, the values of the query
+// parameters holding secrets, and the segments after the query ID of the
+// URIs of the statement protocol, which hold the slug granting access to the
+// results of a query.
+func redactURI(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return redacted
+	}
+	if _, ok := u.User.Password(); ok {
+		u.User = url.UserPassword(u.User.Username(), redacted)
+	}
+	if u.RawQuery != "" {
+		query := u.Query()
+		for k := range query {
+			lower := strings.ToLower(k)
+			for _, s := range sensitiveParams {
+				if strings.Contains(lower, s) {
+					query[k] = []string{redacted}
+				}
+			}
+		}
+		u.RawQuery = query.Encode()
+	}
+	// /v1/statement/{queued,executing}/{queryId}/{slug}/{token} and
+	// /v1/statement/partialCancel/{queryId}/{stage}/{slug}/{token}
+	if parts := strings.Split(u.Path, "/"); len(parts) > 5 && parts[1] == "v1" && parts[2] == "statement" {
+		for i := 5; i < len(parts); i++ {
+			parts[i] = redacted
+		}
+		u.Path = strings.Join(parts, "/")
+	}
+	return u.String()
+}
+
+// redactHeaders returns the headers of a request as a string, without the
+// values of the authentication headers and extra credentials.
+func redactHeaders(h http.Header) string {
+	keys := make([]string, 0, len(h))
+	for k := range h {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	for _, k := range keys {
+		for _, v := range h[k] {
+			switch http.CanonicalHeaderKey(k) {
+			case "Authorization", "Proxy-Authorization", "Cookie":
+				v = redacted
+			case _xTrinoExtraCredentialHeader, _xPrestoExtraCredentialHeader:
+				v = redactKeyValueList(v)
+			}
+			if b.Len() > 0 {
+				b.WriteString(", ")
+			}
+			b.WriteString(k + ": " + v)
+		}
+	}
+	return b.String()
+}
+
+// redactKeyValueList redacts the values of a list of key=value pairs.
+func redactKeyValueList(s string) string {
+	kvs := strings.Split(s, ",")
+	for i, kv := range kvs {
+		if j := strings.Index(kv, "="); j >= 0 {
+			kvs[i] = kv[:j+1] + redacted
+		}
+	}
+	return strings.Join(kvs, ",")
+}
+
+// loggingInterceptor logs the requests to the coordinator.
+func (c *Conn) loggingInterceptor(next RoundTripFunc) RoundTripFunc {
+	return func(ctx context.Context, req *Request) (*Response, error) {
+		if c.logger == nil || c.debug == debugOff {
+			return next(ctx, req)
+		}
+		start := time.Now()
+		resp, err := next(ctx, req)
+		args := []interface{}{
+			"phase", string(req.Phase),
+			"method", req.Method,
+			"uri", redactURI(req.URL.String()),
+			"duration", time.Since(start),
+		}
+		queryID := req.QueryID
+		if resp != nil {
+			args = append(args, "status", resp.StatusCode)
+			if resp.Metadata != nil {
+				queryID = resp.Metadata.QueryID
+				args = append(args, "state", resp.Metadata.Stats.State)
+				if resp.Metadata.Error != nil {
+					args = append(args, "query_error", resp.Metadata.Error.Error())
+				}
+			}
+		}
+		if queryID != "" {
+			args = append(args, "query_id", queryID)
+		}
+		if err != nil {
+			args = append(args, "error", err.Error())
+		}
+		if c.debug >= debugSQL {
+			args = append(args, "headers", redactHeaders(req.Header))
+			if req.Phase == PhaseSubmit && req.GetBody != nil {
+				if body, err := req.GetBody(); err == nil {
+					sql, _ := ioutil.ReadAll(body)
+					args = append(args, "sql", string(sql))
+				}
+			}
+		}
+		c.logger.DebugContext(ctx, "trino request", args...)
+		return resp, err
+	}
+}
+
+// logPage logs the number of rows of a page of results.
+func (qr *driverRows) logPage() {
+	c := qr.stmt.conn
+	if c.logger == nil || c.debug == debugOff {
+		return
+	}
+	c.logger.DebugContext(qr.ctx, "trino page", "query_id", qr.queryID, "rows", qr.rowcount)
+}
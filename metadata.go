@@ -0,0 +1,189 @@
+package trino
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// Metadata lists the catalogs, schemas, tables and columns of a Trino
+// cluster with queries on db, e.g. for a data catalog crawler or for the
+// autocompletion of a SQL editor.
+type Metadata struct {
+	db *sql.DB
+}
+
+// NewMetadata returns the metadata of the cluster of db.
+func NewMetadata(db *sql.DB) *Metadata {
+	return &Metadata{db: db}
+}
+
+// TableName is the name of a table or a view. Catalog and Schema may be
+// empty to use the catalog and schema of the session.
+type TableName struct {
+	Catalog string
+	Schema  string
+	Name    string
+}
+
+// String returns the qualified name of the table, with each part quoted,
+// e.g. "hive"."web"."page views".
+func (n TableName) String() string {
+	var parts []string
+	for _, part := range []string{n.Catalog, n.Schema, n.Name} {
+		if part != "" {
+			parts = append(parts, QuoteIdentifier(part))
+		}
+	}
+	return strings.Join(parts, ".")
+}
+
+// Table is a table or a view listed by Metadata.Tables.
+type Table struct {
+	TableName
+	Type    string // BASE TABLE or VIEW
+	Comment string
+}
+
+// TableColumn is a column listed by Metadata.Columns.
+type TableColumn struct {
+	Name       string
+	Type       string // e.g. varchar(10)
+	ParsedType Type   // only holds the name of a type that could not be parsed
+	Extra      string
+	Comment    string
+}
+
+// Catalogs returns the names of the catalogs.
+func (m *Metadata) Catalogs(ctx context.Context) ([]string, error) {
+	return m.strings(ctx, "SELECT catalog_name FROM system.metadata.catalogs ORDER BY catalog_name")
+}
+
+// Schemas returns the names of the schemas of catalog.
+func (m *Metadata) Schemas(ctx context.Context, catalog string) ([]string, error) {
+	if catalog == "" {
+		return nil, fmt.Errorf("trino: missing catalog")
+	}
+	return m.strings(ctx, "SELECT schema_name FROM "+QuoteIdentifier(catalog)+".information_schema.schemata ORDER BY schema_name")
+}
+
+// Tables returns the tables and views of a schema whose name matches
+// pattern, a LIKE pattern where _ and % are wildcards. An empty pattern
+// matches all the tables.
+func (m *Metadata) Tables(ctx context.Context, catalog, schema, pattern string) ([]Table, error) {
+	if catalog == "" || schema == "" {
+		return nil, fmt.Errorf("trino: missing catalog or schema")
+	}
+	if pattern == "" {
+		pattern = "%"
+	}
+	rows, err := m.db.QueryContext(ctx,
+		"SELECT table_name, table_type FROM "+QuoteIdentifier(catalog)+".information_schema.tables "+
+			"WHERE table_schema = ? AND table_name LIKE ? ORDER BY table_name",
+		schema, pattern)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var tables []Table
+	for rows.Next() {
+		t := Table{TableName: TableName{Catalog: catalog, Schema: schema}}
+		if err := rows.Scan(&t.Name, &t.Type); err != nil {
+			return nil, err
+		}
+		tables = append(tables, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(tables) == 0 {
+		return tables, nil
+	}
+
+	rows, err = m.db.QueryContext(ctx,
+		"SELECT table_name, comment FROM system.metadata.table_comments "+
+			"WHERE catalog_name = ? AND schema_name = ? AND table_name LIKE ? AND comment IS NOT NULL",
+		catalog, schema, pattern)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	comments := make(map[string]string)
+	for rows.Next() {
+		var name, comment string
+		if err := rows.Scan(&name, &comment); err != nil {
+			return nil, err
+		}
+		comments[name] = comment
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	for i := range tables {
+		tables[i].Comment = comments[tables[i].Name]
+	}
+	return tables, nil
+}
+
+// Columns returns the columns of a table or a view, with their types
+// parsed by ParseType.
+func (m *Metadata) Columns(ctx context.Context, table TableName) ([]TableColumn, error) {
+	if table.Name == "" {
+		return nil, fmt.Errorf("trino: missing table name")
+	}
+	rows, err := m.db.QueryContext(ctx, "SHOW COLUMNS FROM "+table.String())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var columns []TableColumn
+	for rows.Next() {
+		var c TableColumn
+		var extra, comment sql.NullString
+		if err := rows.Scan(&c.Name, &c.Type, &extra, &comment); err != nil {
+			return nil, err
+		}
+		c.Extra, c.Comment = extra.String, comment.String
+		c.ParsedType = parseTypeOrName(c.Type)
+		columns = append(columns, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return columns, nil
+}
+
+// ViewDefinition returns the query of a view. Its error wraps
+// sql.ErrNoRows when there is no such view.
+func (m *Metadata) ViewDefinition(ctx context.Context, view TableName) (string, error) {
+	if view.Catalog == "" || view.Schema == "" || view.Name == "" {
+		return "", fmt.Errorf("trino: view name must be qualified with a catalog and a schema: %s", view)
+	}
+	var definition string
+	err := m.db.QueryRowContext(ctx,
+		"SELECT view_definition FROM "+QuoteIdentifier(view.Catalog)+".information_schema.views "+
+			"WHERE table_schema = ? AND table_name = ?",
+		view.Schema, view.Name).Scan(&definition)
+	if err == sql.ErrNoRows {
+		return "", fmt.Errorf("trino: no view %s: %w", view, err)
+	}
+	return definition, err
+}
+
+func (m *Metadata) strings(ctx context.Context, query string) ([]string, error) {
+	rows, err := m.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
+}
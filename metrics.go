@@ -0,0 +1,139 @@
+package trino
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// Metrics receives measurements of the queries run through a Connector,
+// e.g. to export them to Prometheus with the trinoprom package. Its
+// methods are called concurrently, and must not block.
+type Metrics interface {
+	// QueryStarted is called when a query is about to be submitted.
+	QueryStarted(labels MetricsLabels)
+	// QueryCompleted is called when a query completed successfully.
+	// queued is the time it spent queued in Trino.
+	QueryCompleted(labels MetricsLabels, duration, queued time.Duration)
+	// QueryFailed is called when a query failed, with the type of the
+	// error, see ErrorType.
+	QueryFailed(labels MetricsLabels, errorType string, duration time.Duration)
+	// QueryCancelled is called when a query is cancelled, by its context or
+	// by closing its rows before the end.
+	QueryCancelled(labels MetricsLabels, duration time.Duration)
+	// HTTPResponse is called for every response of the coordinator to the
+	// requests submitting a query or fetching its results. retried is set
+	// when the request is retried, after a 503 status.
+	HTTPResponse(labels MetricsLabels, statusCode int, retried bool)
+	// Received is called with the number of rows and bytes of results
+	// received.
+	Received(labels MetricsLabels, rows, bytes int64)
+}
+
+// MetricsLabels identify where measurements come from.
+type MetricsLabels struct {
+	Connector string // the Name of the Connector
+	Catalog   string
+	Source    string
+}
+
+// Error types reported to Metrics.QueryFailed, besides the ones of the
+// errors returned by Trino, such as USER_ERROR or INSUFFICIENT_RESOURCES.
+const (
+	ErrorTypeWarning = "WARNING"       // ErrQueryWarning
+	ErrorTypeTimeout = "TIMEOUT"       // the deadline of the context expired
+	ErrorTypeHTTP    = "HTTP"          // the coordinator answered with an HTTP error
+	ErrorTypeClient  = "CLIENT"        // the coordinator couldn't be reached, or the response couldn't be read
+	ErrorTypeUnknown = "UNKNOWN_ERROR" // Trino didn't report the type of the error
+)
+
+// ErrorType returns the type of the error of a failed query, as reported to
+// Metrics.QueryFailed.
+func ErrorType(err error) string {
+	if qf, ok := err.(*ErrQueryFailed); ok {
+		if se, ok := qf.Reason.(*stmtError); ok {
+			if se.ErrorType == "" {
+				return ErrorTypeUnknown
+			}
+			return se.ErrorType
+		}
+		if qf.StatusCode != 0 {
+			return ErrorTypeHTTP
+		}
+		err = qf.Reason
+	}
+	if _, ok := err.(*ErrQueryWarning); ok {
+		return ErrorTypeWarning
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return ErrorTypeTimeout
+	}
+	if te, ok := err.(interface{ Timeout() bool }); ok && te.Timeout() {
+		return ErrorTypeTimeout
+	}
+	return ErrorTypeClient
+}
+
+// isCancellation reports whether err is the cancellation of a query, rather
+// than its failure.
+func isCancellation(err error) bool {
+	if qf, ok := err.(*ErrQueryFailed); ok {
+		err = qf.Reason
+	}
+	return err == ErrQueryCancelled || errors.Is(err, context.Canceled)
+}
+
+// queryMetrics reports the measurements of a query to Metrics.
+type queryMetrics struct {
+	metrics Metrics
+	labels  MetricsLabels
+	start   time.Time
+}
+
+type queryMetricsKey struct{}
+
+// newQueryMetrics returns the metrics of a query, or nil when the
+// connection has no Metrics.
+func (c *Conn) newQueryMetrics(catalog string) *queryMetrics {
+	if c.metrics == nil {
+		return nil
+	}
+	if catalog == "" {
+		catalog = c.httpHeaders.Get(vhs[v]["catalog"])
+	}
+	m := &queryMetrics{
+		metrics: c.metrics,
+		labels: MetricsLabels{
+			Connector: c.name,
+			Catalog:   catalog,
+			Source:    c.httpHeaders.Get(vhs[v]["source"]),
+		},
+		start: time.Now(),
+	}
+	m.metrics.QueryStarted(m.labels)
+	return m
+}
+
+// queryMetricsFromContext returns the metrics of the query of ctx, if any.
+func queryMetricsFromContext(ctx context.Context) *queryMetrics {
+	m, _ := ctx.Value(queryMetricsKey{}).(*queryMetrics)
+	return m
+}
+
+func (m *queryMetrics) completed(stats QueryStats) {
+	m.metrics.QueryCompleted(m.labels, time.Since(m.start), time.Duration(stats.QueuedTimeMillis)*time.Millisecond)
+}
+
+func (m *queryMetrics) failed(err error) {
+	if isCancellation(err) {
+		m.metrics.QueryCancelled(m.labels, time.Since(m.start))
+		return
+	}
+	m.metrics.QueryFailed(m.labels, ErrorType(err), time.Since(m.start))
+}
+
+func (m *queryMetrics) received(rows, bytes int64) {
+	if rows > 0 || bytes > 0 {
+		m.metrics.Received(m.labels, rows, bytes)
+	}
+}
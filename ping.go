@@ -0,0 +1,155 @@
+package trino
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync/atomic"
+)
+
+// PingFailure is the reason a ping failed.
+type PingFailure int
+
+const (
+	// PingUnreachable means the coordinator could not be reached.
+	PingUnreachable PingFailure = iota + 1
+	// PingAuthFailed means the coordinator rejected the credentials.
+	PingAuthFailed
+	// PingStarting means the coordinator is up but still starting.
+	PingStarting
+	// PingServerError means the coordinator answered with an error.
+	PingServerError
+)
+
+func (f PingFailure) String() string {
+	switch f {
+	case PingUnreachable:
+		return "coordinator unreachable"
+	case PingAuthFailed:
+		return "authentication failed"
+	case PingStarting:
+		return "coordinator starting"
+	case PingServerError:
+		return "server error"
+	}
+	return fmt.Sprintf("PingFailure(%d)", int(f))
+}
+
+// ErrPingFailed is returned by Conn.Ping, and by db.PingContext.
+type ErrPingFailed struct {
+	Failure    PingFailure
+	StatusCode int
+	Reason     error
+}
+
+// Error implements the error interface.
+func (e *ErrPingFailed) Error() string {
+	if e.Reason == nil {
+		return fmt.Sprintf("trino: ping failed: %s", e.Failure)
+	}
+	return fmt.Sprintf("trino: ping failed: %s: %v", e.Failure, e.Reason)
+}
+
+// serverInfo is the response of the /v1/info endpoint.
+type serverInfo struct {
+	NodeVersion struct {
+		Version string `json:"version"`
+	} `json:"nodeVersion"`
+	Environment string `json:"environment"`
+	Coordinator bool   `json:"coordinator"`
+	Starting    bool   `json:"starting"`
+	Uptime      string `json:"uptime"`
+}
+
+var _ driver.Pinger = &Conn{}
+
+// Ping implements the driver.Pinger interface. It checks that the
+// coordinator answers on /v1/info and is done starting. If the endpoint is
+// not available, for example behind a gateway, the ping query set in the
+// DSN is run instead when there is one. With several hosts, the ping
+// succeeds if one of them is up.
+func (c *Conn) Ping(ctx context.Context) error {
+	var err error
+	for _, host := range c.hosts.order(0) {
+		if err = c.pingHost(ctx, host); err == nil {
+			c.hosts.markUp(host)
+			return nil
+		}
+		if pf, ok := err.(*ErrPingFailed); ok && pf.Failure == PingUnreachable {
+			c.hosts.markDown(host)
+		}
+	}
+	if pf, ok := err.(*ErrPingFailed); ok && (pf.Failure == PingUnreachable || pf.Failure == PingAuthFailed) {
+		atomic.StoreInt32(&c.bad, 1)
+	}
+	return err
+}
+
+func (c *Conn) pingHost(ctx context.Context, host string) error {
+	req, err := c.newRequest("GET", host+"/v1/info", nil, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.do(ctx, &Request{Request: req.WithContext(ctx), Phase: PhaseInfo})
+	if err != nil {
+		if qf, ok := err.(*ErrQueryFailed); ok {
+			err = qf.Reason
+		}
+		return &ErrPingFailed{Failure: PingUnreachable, Reason: err}
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		var info serverInfo
+		if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+			if c.pingQuery != "" {
+				return c.pingWithQuery(ctx)
+			}
+			return &ErrPingFailed{Failure: PingServerError, StatusCode: resp.StatusCode, Reason: err}
+		}
+		if info.Starting {
+			return &ErrPingFailed{Failure: PingStarting, StatusCode: resp.StatusCode}
+		}
+		return nil
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return &ErrPingFailed{Failure: PingAuthFailed, StatusCode: resp.StatusCode, Reason: newErrQueryFailedFromResponse(resp.Response).Reason}
+	default:
+		if c.pingQuery != "" {
+			return c.pingWithQuery(ctx)
+		}
+		return &ErrPingFailed{Failure: PingServerError, StatusCode: resp.StatusCode, Reason: newErrQueryFailedFromResponse(resp.Response).Reason}
+	}
+}
+
+// pingWithQuery runs the ping query to the end.
+func (c *Conn) pingWithQuery(ctx context.Context) error {
+	st := &driverStmt{conn: c, query: c.pingQuery}
+	rows, err := st.submit(ctx, nil)
+	if err == nil {
+		defer rows.Close()
+		for rows.nextURI != "" && err == nil {
+			err = rows.fetch(true)
+		}
+		if err == io.EOF {
+			err = nil
+		}
+	}
+	if err == nil {
+		return nil
+	}
+	qf, ok := err.(*ErrQueryFailed)
+	switch {
+	case !ok:
+		return &ErrPingFailed{Failure: PingServerError, Reason: err}
+	case qf.StatusCode == 0:
+		return &ErrPingFailed{Failure: PingUnreachable, Reason: qf.Reason}
+	case qf.StatusCode == http.StatusUnauthorized || qf.StatusCode == http.StatusForbidden:
+		return &ErrPingFailed{Failure: PingAuthFailed, StatusCode: qf.StatusCode, Reason: qf.Reason}
+	default:
+		return &ErrPingFailed{Failure: PingServerError, StatusCode: qf.StatusCode, Reason: qf.Reason}
+	}
+}
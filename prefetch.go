@@ -0,0 +1,90 @@
+package trino
+
+import "context"
+
+// prefetcher fetches the pages of results of a query ahead of the consumer
+// of its rows, so that the round-trips to the coordinator overlap with the
+// processing of the rows. At most size pages are buffered; once the buffer
+// is full the prefetcher waits for the consumer, which in turn makes Trino
+// hold the query's output.
+type prefetcher struct {
+	pages  chan prefetchedPage
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// prefetchedPage is the outcome of fetching a page of results.
+type prefetchedPage struct {
+	resp       *queryResponse
+	statusCode int
+	err        error
+}
+
+// newPrefetcher starts fetching the pages of qr from its current nextUri.
+func newPrefetcher(qr *driverRows, size int) *prefetcher {
+	ctx, cancel := context.WithCancel(qr.ctx)
+	p := &prefetcher{
+		pages:  make(chan prefetchedPage, size),
+		ctx:    ctx,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	go p.run(ctx, qr, qr.nextURI, qr.queryID)
+	return p
+}
+
+func (p *prefetcher) run(ctx context.Context, qr *driverRows, nextURI, queryID string) {
+	defer close(p.done)
+	defer close(p.pages)
+	for nextURI != "" {
+		// the columns of the query are read by the consumer, the rows are
+		// decoded with the ones of their page
+		resp, statusCode, err := qr.get(ctx, nextURI, queryID, nil, nil)
+		select {
+		case p.pages <- prefetchedPage{resp: resp, statusCode: statusCode, err: err}:
+		case <-ctx.Done():
+			return
+		}
+		if err != nil || handleResponseError(statusCode, resp.Error) != nil {
+			return
+		}
+		nextURI = resp.NextURI
+		// the query is cancelled from the last page fetched, which is ahead
+		// of the one being read
+		qr.canceller.update(nextURI)
+	}
+}
+
+// next returns the next page, waiting for it to be fetched if needed.
+func (p *prefetcher) next() (*queryResponse, int, error) {
+	pg, ok := <-p.pages
+	if !ok {
+		// the context of the query was cancelled or timed out
+		if err := p.ctx.Err(); err != nil {
+			return nil, 0, err
+		}
+		return nil, 0, ErrQueryCancelled
+	}
+	return pg.resp, pg.statusCode, pg.err
+}
+
+// drain returns the pages fetched but not read, up to the first error,
+// once the prefetcher is stopped.
+func (p *prefetcher) drain() []*queryResponse {
+	var pages []*queryResponse
+	for pg := range p.pages {
+		if pg.err != nil || handleResponseError(pg.statusCode, pg.resp.Error) != nil {
+			break
+		}
+		pages = append(pages, pg.resp)
+	}
+	return pages
+}
+
+// stop stops fetching pages and waits for the request in flight, if any, to
+// be aborted, so that the query can be cancelled safely.
+func (p *prefetcher) stop() {
+	p.cancel()
+	<-p.done
+}
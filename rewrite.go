@@ -0,0 +1,38 @@
+package trino
+
+import "net/url"
+
+// URIRewriter rewrites the URIs advertised by the coordinator, such as the
+// nextUri of a query, before they are used. It's needed when the
+// coordinator is reached through a proxy, gateway or NAT and advertises
+// URIs with a hostname only valid inside its network. It must not modify
+// its argument, and may return it unchanged, or nil to keep it.
+type URIRewriter func(uri *url.URL) *url.URL
+
+// rewriteURI rewrites uri, advertised by the coordinator at server, with
+// the connection's URIRewriter, or to server when the rewrite_uris DSN
+// parameter is set. URIs that can't be parsed are returned unchanged, to
+// fail when they are used.
+func (c *Conn) rewriteURI(server, uri string) string {
+	if (c.uriRewriter == nil && !c.rewriteURIs) || uri == "" {
+		return uri
+	}
+	u, err := url.Parse(uri)
+	if err != nil {
+		return uri
+	}
+	if c.uriRewriter != nil {
+		if rewritten := c.uriRewriter(u); rewritten != nil {
+			return rewritten.String()
+		}
+		return uri
+	}
+	s, err := url.Parse(server)
+	if err != nil {
+		return uri
+	}
+	// keep the path and query
+	u.Scheme = s.Scheme
+	u.Host = s.Host
+	return u.String()
+}
@@ -5,55 +5,149 @@ import (
 	"database/sql"
 	"database/sql/driver"
 	"encoding/json"
-	"fmt"
 	"io"
 	"net/http"
 	"regexp"
-	"time"
+	"sync/atomic"
 )
 
 // driverRows implements driver.Rows
 type driverRows struct {
-	ctx     context.Context
-	stmt    *driverStmt
-	nextURI string
+	// read from the responses to polls, first for the alignment of atomic
+	// operations on 32-bit platforms
+	bytes         int64
+	reportedBytes int64 // to metrics
+
+	ctx        context.Context
+	cancel     context.CancelFunc
+	stmt       *driverStmt
+	server     string // base URL of the coordinator running the query
+	span       Span   // of the query, nil unless traced
+	user       string
+	callback   QueryCallBack
+	tracker    *queryTracker
+	canceller  *queryCanceller
+	prefetch   int // number of pages fetched ahead, 0 to fetch them on demand
+	prefetcher *prefetcher
+	nextURI    string
 
 	err      error
 	rowindex int
 	columns  []string
 	coltype  []*typeConverter
-	data     []queryData
+	colinfo  []queryColumn
+	data     []driver.Value // values of the rows of the current page
+	rowcount int            // number of rows of the current page
+
+	queryID          string
+	stats            QueryStats
+	updateType       string
+	updateCount      int64
+	partialCancelURI string
+
+	maxRows   int64
+	rowsRead  int64
+	truncated bool
 }
 
-var _ driver.Rows = &driverRows{}
+var (
+	_ driver.Rows        = &driverRows{}
+	_ QueryStatsProvider = &driverRows{}
+	_ WarningsProvider   = &driverRows{}
+	_ TruncationProvider = &driverRows{}
+)
+
+// TruncationProvider is implemented by the driver.Rows values of this
+// driver, see QueryStatsProvider for how to reach them.
+type TruncationProvider interface {
+	// Truncated reports whether the iteration stopped at the limit set with
+	// WithMaxRows while the query had more results.
+	Truncated() bool
+}
 
 func (qr *driverRows) Close() error {
+	if qr.span == nil {
+		return qr.close()
+	}
+	_, span := startSpan(qr.ctx, qr.stmt.conn.tracer, SpanClose)
+	err := qr.close()
+	endSpan(span, err)
+	qr.span.SetAttributes(
+		Attribute{AttrQueryID, qr.queryID},
+		Attribute{AttrState, qr.stats.State},
+		Attribute{AttrRows, qr.rowsRead},
+		Attribute{AttrBytes, atomic.LoadInt64(&qr.bytes)},
+		Attribute{AttrProcessedRows, qr.stats.ProcessedRows},
+		Attribute{AttrProcessedBytes, qr.stats.ProcessedBytes},
+	)
+	if qr.err != nil {
+		// the error that ended the iteration
+		endSpan(qr.span, qr.err)
+	} else {
+		endSpan(qr.span, err)
+	}
+	qr.span = nil
+	return err
+}
+
+func (qr *driverRows) close() error {
+	if qr.cancel != nil {
+		defer qr.cancel()
+	}
+	defer qr.stmt.conn.untrackRows(qr)
+	if qr.prefetcher != nil {
+		qr.prefetcher.stop()
+		// the last page may have been fetched already, in which case the
+		// query is done rather than cancelled
+		for _, resp := range qr.prefetcher.drain() {
+			qr.tracker.update(resp.Stats, resp.Warnings)
+			qr.stats = resp.Stats
+			qr.nextURI = resp.NextURI
+		}
+		if qr.nextURI == "" {
+			qr.tracker.completed(qr.stats)
+		}
+	}
 	if qr.nextURI != "" {
-		hs := make(http.Header)
-		hs.Add(vhs[v]["user"], qr.stmt.user)
-		req, err := qr.stmt.conn.newRequest("DELETE", qr.nextURI, nil, hs)
-		if err != nil {
-			return err
+		qr.tracker.failed(ErrQueryCancelled)
+		if qr.ctx.Err() != nil {
+			// the context was cancelled, don't keep the caller waiting
+			go qr.canceller.cancel()
+			qr.nextURI = ""
+			return qr.err
 		}
-		ctx, cancel := context.WithDeadline(
-			context.Background(),
-			time.Now().Add(DefaultCancelQueryTimeout),
-		)
-		defer cancel()
-		resp, err := qr.stmt.conn.roundTrip(ctx, req)
-		if err != nil {
-			qferr, ok := err.(*ErrQueryFailed)
-			if ok && qferr.StatusCode == http.StatusNoContent {
-				qr.nextURI = ""
-				return nil
-			}
+		if err := qr.canceller.cancel(); err != nil {
 			return err
 		}
-		resp.Body.Close()
+		qr.nextURI = ""
 	}
 	return qr.err
 }
 
+// QueryID implements the QueryStatsProvider interface.
+func (qr *driverRows) QueryID() string {
+	return qr.queryID
+}
+
+// QueryStats implements the QueryStatsProvider interface.
+func (qr *driverRows) QueryStats() QueryStats {
+	return qr.stats
+}
+
+// Warnings implements the WarningsProvider interface.
+func (qr *driverRows) Warnings() []Warning {
+	return append([]Warning(nil), qr.tracker.warnings...)
+}
+
+// headers returns the per-query headers sent when polling or cancelling.
+func (qr *driverRows) headers() http.Header {
+	hs := make(http.Header)
+	if qr.user != "" {
+		hs.Add(vhs[v]["user"], qr.user)
+	}
+	return hs
+}
+
 func (qr *driverRows) Columns() []string {
 	if qr.err != nil {
 		return []string{}
@@ -81,7 +175,20 @@ func (qr *driverRows) Next(dest []driver.Value) error {
 	if qr.err != nil {
 		return qr.err
 	}
-	if qr.columns == nil || qr.rowindex >= len(qr.data) {
+	if qr.maxRows > 0 && qr.rowsRead >= qr.maxRows {
+		if qr.rowindex >= qr.rowcount && qr.nextURI != "" {
+			// the results are only truncated if there is another row,
+			// Trino often ends with a page without any
+			if err := qr.fetch(true); err != nil && err != io.EOF {
+				qr.err = err
+				return err
+			}
+		}
+		qr.truncate()
+		qr.err = io.EOF
+		return qr.err
+	}
+	if qr.columns == nil || qr.rowindex >= qr.rowcount {
 		if qr.nextURI == "" {
 			qr.err = io.EOF
 			return qr.err
@@ -95,79 +202,189 @@ func (qr *driverRows) Next(dest []driver.Value) error {
 		qr.err = sql.ErrNoRows
 		return qr.err
 	}
-	for i, v := range qr.coltype {
-		vv, err := v.ConvertValue(qr.data[qr.rowindex][i])
-		if err != nil {
-			qr.err = err
-			return err
-		}
-		dest[i] = vv
-	}
+	copy(dest, qr.data[qr.rowindex*len(qr.coltype):])
 	qr.rowindex++
+	qr.rowsRead++
 	return nil
 }
 
+// truncate stops a query whose remaining results are not needed, letting
+// the cluster stop working on it right away. The query is reported as
+// cancelled unless Trino already sent all of its results.
+func (qr *driverRows) truncate() {
+	if qr.rowindex >= qr.rowcount && qr.nextURI == "" {
+		return
+	}
+	qr.truncated = true
+	if qr.nextURI == "" {
+		return
+	}
+	qr.nextURI = ""
+	qr.stmt.conn.untrackRows(qr)
+	qr.tracker.failed(ErrQueryCancelled)
+	go func() {
+		if qr.prefetcher != nil {
+			qr.prefetcher.stop()
+		}
+		qr.canceller.stop(qr.partialCancelURI)
+	}()
+}
+
+// Truncated implements the TruncationProvider interface.
+func (qr *driverRows) Truncated() bool {
+	return qr.truncated
+}
+
 type queryResponse struct {
-	ID               string        `json:"id"`
-	InfoURI          string        `json:"infoUri"`
-	PartialCancelURI string        `json:"partialCancelUri"`
-	NextURI          string        `json:"nextUri"`
-	Columns          []queryColumn `json:"columns"`
-	Data             []queryData   `json:"data"`
-	Stats            stmtStats     `json:"stats"`
-	Error            stmtError     `json:"error"`
+	ID               string          `json:"id"`
+	InfoURI          string          `json:"infoUri"`
+	PartialCancelURI string          `json:"partialCancelUri"`
+	NextURI          string          `json:"nextUri"`
+	Columns          []queryColumn   `json:"columns"`
+	Data             json.RawMessage `json:"data"`
+	Stats            QueryStats      `json:"stats"`
+	Error            stmtError       `json:"error"`
+	Warnings         []Warning       `json:"warnings"`
+	UpdateType       string          `json:"updateType"`
+	UpdateCount      int64           `json:"updateCount"`
+
+	// the rows of the data when they were decoded with the response, in
+	// which case Data is nil
+	values   []driver.Value
+	rowcount int
+	coltype  []*typeConverter // of the columns, when made to decode the rows
 }
 
 type queryColumn struct {
 	Name          string        `json:"name"`
 	Type          string        `json:"type"`
-	TypeSignature typeSignature `json:"typeSignature"`
+	TypeSignature TypeSignature `json:"typeSignature"`
 }
 
-type queryData []interface{}
-
-type typeSignature struct {
+// TypeSignature is the structured form of the type of a column, e.g. the
+// raw type varchar with the literal argument 10 for varchar(10). Type
+// arguments are nested type signatures, as decoded from JSON.
+type TypeSignature struct {
 	RawType          string        `json:"rawType"`
 	TypeArguments    []interface{} `json:"typeArguments"`
 	LiteralArguments []interface{} `json:"literalArguments"`
 }
 
+// get fetches and decodes the page of results at nextURI, decoding its rows
+// with coltype into values as with Response.queryResponse. It runs in the
+// prefetcher concurrently with fetch, so it is given the query ID rather
+// than reading the fields fetch updates.
+func (qr *driverRows) get(ctx context.Context, nextURI, queryID string, coltype []*typeConverter, values []driver.Value) (qresp *queryResponse, statusCode int, err error) {
+	ctx, span := startSpan(ctx, qr.stmt.conn.tracer, SpanPoll)
+	if span != nil {
+		defer func() {
+			if statusCode != 0 {
+				span.SetAttributes(Attribute{AttrStatusCode, int64(statusCode)})
+			}
+			if qresp != nil {
+				span.SetAttributes(Attribute{AttrState, qresp.Stats.State})
+			}
+			endSpan(span, err)
+		}()
+	}
+	req, err := qr.stmt.conn.newRequest("GET", nextURI, nil, qr.headers())
+	if err != nil {
+		return nil, 0, err
+	}
+	resp, err := qr.stmt.conn.roundTrip(ctx, &Request{Request: req.WithContext(ctx), Phase: PhasePoll, QueryID: queryID})
+	if err != nil {
+		return nil, 0, err
+	}
+	qresp, n, err := resp.queryResponse(coltype, values)
+	atomic.AddInt64(&qr.bytes, n)
+	if span != nil {
+		span.SetAttributes(Attribute{AttrBytes, n})
+	}
+	if err != nil {
+		return nil, resp.StatusCode, err
+	}
+	qresp.NextURI = qr.stmt.conn.rewriteURI(qr.server, qresp.NextURI)
+	qresp.InfoURI = qr.stmt.conn.rewriteURI(qr.server, qresp.InfoURI)
+	qresp.PartialCancelURI = qr.stmt.conn.rewriteURI(qr.server, qresp.PartialCancelURI)
+	return qresp, resp.StatusCode, nil
+}
+
 func (qr *driverRows) fetch(allowEOF bool) error {
-	hs := make(http.Header)
-	hs.Add(vhs[v]["user"], qr.stmt.user)
-	req, err := qr.stmt.conn.newRequest("GET", qr.nextURI, nil, hs)
+	var (
+		qresp      *queryResponse
+		statusCode int
+		err        error
+	)
+	if qr.prefetch > 0 {
+		if qr.prefetcher == nil {
+			qr.prefetcher = newPrefetcher(qr, qr.prefetch)
+		}
+		qresp, statusCode, err = qr.prefetcher.next()
+	} else {
+		qresp, statusCode, err = qr.get(qr.ctx, qr.nextURI, qr.queryID, qr.coltype, qr.data[:0])
+	}
 	if err != nil {
+		qr.tracker.failed(err)
 		return err
 	}
-	resp, err := qr.stmt.conn.roundTrip(qr.ctx, req)
+	warningErr := qr.tracker.update(qresp.Stats, qresp.Warnings)
+	err = handleResponseError(statusCode, qresp.Error)
 	if err != nil {
+		qr.canceller.update("")
+		qr.tracker.failed(err)
 		return err
 	}
-	defer resp.Body.Close()
-	var qresp queryResponse
-	d := json.NewDecoder(resp.Body)
-	d.UseNumber()
-	err = d.Decode(&qresp)
-	if err != nil {
-		return fmt.Errorf("trino: %v", err)
+	if qr.columns == nil && len(qresp.Columns) > 0 {
+		qr.initColumns(qresp)
+	}
+	qr.rowindex = 0
+	if qresp.Data == nil {
+		qr.data, qr.rowcount = qresp.values, qresp.rowcount
+	} else {
+		qr.data, qr.rowcount, err = qr.decodeRows(qresp.Data)
 	}
-	err = handleResponseError(resp.StatusCode, qresp.Error)
 	if err != nil {
+		qr.canceller.update("")
+		qr.tracker.failed(err)
 		return err
 	}
-	qr.rowindex = 0
-	qr.data = qresp.Data
+	if m := qr.tracker.metrics; m != nil {
+		bytes := atomic.LoadInt64(&qr.bytes)
+		m.received(int64(qr.rowcount), bytes-qr.reportedBytes)
+		qr.reportedBytes = bytes
+	}
 	qr.nextURI = qresp.NextURI
+	if qr.prefetcher == nil {
+		qr.canceller.update(qr.nextURI)
+	}
+	qr.queryID = qresp.ID
+	qr.stats = qresp.Stats
+	qr.logPage()
+	qr.partialCancelURI = qresp.PartialCancelURI
+	if qresp.UpdateType != "" {
+		qr.updateType = qresp.UpdateType
+		qr.updateCount = qresp.UpdateCount
+	}
 
-	if qr.stmt.callback != nil {
-		qr.stmt.callback.OnUpdated(QueryInfo{
+	if qr.callback != nil {
+		qr.callback.OnUpdated(QueryInfo{
 			Id:         qresp.ID,
 			QueryStats: qresp.Stats,
-			Cancel:     qr.Close,
+			Warnings:   qr.Warnings(),
+			Cancel:     qr.canceller.cancel,
 		})
 	}
 
-	if len(qr.data) == 0 {
+	if warningErr != nil {
+		qr.tracker.failed(warningErr)
+		return warningErr
+	}
+	if qr.nextURI == "" {
+		qr.stmt.conn.untrackRows(qr)
+		qr.tracker.completed(qresp.Stats)
+	}
+
+	if qr.rowcount == 0 {
 		if qr.nextURI != "" {
 			return qr.fetch(allowEOF)
 		}
@@ -178,18 +395,20 @@ func (qr *driverRows) fetch(allowEOF bool) error {
 		// 有数据之后不能忽略 next uri，数据可能是分段传输的
 		// qr.nextURI = ""
 	}
-
-	if qr.columns == nil && len(qresp.Columns) > 0 {
-		qr.initColumns(&qresp)
-	}
 	return nil
 }
 
 func (qr *driverRows) initColumns(qresp *queryResponse) {
+	qr.colinfo = qresp.Columns
 	qr.columns = make([]string, len(qresp.Columns))
-	qr.coltype = make([]*typeConverter, len(qresp.Columns))
+	qr.coltype = qresp.coltype
+	if qr.coltype == nil {
+		qr.coltype = make([]*typeConverter, len(qresp.Columns))
+		for i, col := range qresp.Columns {
+			qr.coltype[i] = newTypeConverter(col.Type)
+		}
+	}
 	for i, col := range qresp.Columns {
 		qr.columns[i] = col.Name
-		qr.coltype[i] = newTypeConverter(col.Type)
 	}
 }
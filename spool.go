@@ -0,0 +1,291 @@
+package trino
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultSpoolingWorkers is the number of spooled segments of results
+// downloaded at the same time, unless set with the spooling_workers DSN
+// parameter.
+var DefaultSpoolingWorkers = 4
+
+// SegmentDecoder decompresses a segment of results spooled with a
+// compressed encoding, such as json+zstd. uncompressedSize is the size of
+// the decompressed segment.
+type SegmentDecoder func(data []byte, uncompressedSize int) ([]byte, error)
+
+var segmentDecoderRegistry = struct {
+	sync.RWMutex
+	Index map[string]SegmentDecoder
+}{
+	Index: map[string]SegmentDecoder{
+		"json+lz4": decodeLZ4Block,
+	},
+}
+
+// RegisterSegmentDecoder registers the decoder of segments spooled with the
+// given encoding, so that it can be requested with the encoding DSN
+// parameter. The json and json+lz4 encodings are supported out of the box;
+// json+zstd can be registered with the zstd library of your choice:
+//
+//	trino.RegisterSegmentDecoder("json+zstd", func(data []byte, size int) ([]byte, error) {
+//		return zstdDecoder.DecodeAll(data, make([]byte, 0, size))
+//	})
+func RegisterSegmentDecoder(encoding string, decoder SegmentDecoder) {
+	segmentDecoderRegistry.Lock()
+	segmentDecoderRegistry.Index[encoding] = decoder
+	segmentDecoderRegistry.Unlock()
+}
+
+func getSegmentDecoder(encoding string) SegmentDecoder {
+	segmentDecoderRegistry.RLock()
+	defer segmentDecoderRegistry.RUnlock()
+	return segmentDecoderRegistry.Index[encoding]
+}
+
+// validateEncodings checks that the encodings requested in the DSN can be
+// decoded.
+func validateEncodings(encodings []string) error {
+	for _, encoding := range encodings {
+		if encoding != "json" && getSegmentDecoder(encoding) == nil {
+			return fmt.Errorf("trino: unsupported encoding %q, see RegisterSegmentDecoder", encoding)
+		}
+	}
+	return nil
+}
+
+// spooledData is the data of a page of results sent with the spooling
+// protocol, in place of the classic data array.
+type spooledData struct {
+	Encoding string    `json:"encoding"`
+	Segments []segment `json:"segments"`
+}
+
+// segment is a part of the results, either inline or spooled to storage
+// from which it has to be downloaded.
+type segment struct {
+	Type     string              `json:"type"`
+	Data     []byte              `json:"data"` // inline
+	URI      string              `json:"uri"`  // spooled
+	AckURI   string              `json:"ackUri"`
+	Headers  map[string][]string `json:"headers"`
+	Metadata segmentMetadata     `json:"metadata"`
+}
+
+type segmentMetadata struct {
+	RowOffset        int64 `json:"rowOffset"`
+	RowsCount        int64 `json:"rowsCount"`
+	SegmentSize      int64 `json:"segmentSize"`
+	UncompressedSize int   `json:"uncompressedSize"` // only set when compressed
+}
+
+// decodeRows decodes the values of the rows of a page of results, whether
+// they are sent inline as a data array or with the spooling protocol.
+func (qr *driverRows) decodeRows(data json.RawMessage) ([]driver.Value, int, error) {
+	values := qr.data[:0]
+	s := dataScanner{buf: data}
+	s.skipSpace()
+	if s.pos == len(s.buf) || s.buf[s.pos] != '{' {
+		return decodeData(values, data, qr.coltype)
+	}
+	var sd spooledData
+	if err := json.Unmarshal(data, &sd); err != nil {
+		return values, 0, fmt.Errorf("trino: %v", err)
+	}
+	segments, err := qr.loadSegments(sd)
+	if err != nil {
+		return values, 0, err
+	}
+	rows := 0
+	for _, seg := range segments {
+		var n int
+		values, n, err = decodeData(values, seg, qr.coltype)
+		rows += n
+		if err != nil {
+			return values, rows, err
+		}
+	}
+	return values, rows, nil
+}
+
+// loadSegments returns the decompressed segments of sd, in order. Spooled
+// segments are downloaded concurrently, and acknowledged once downloaded so
+// that the server can delete them.
+func (qr *driverRows) loadSegments(sd spooledData) ([][]byte, error) {
+	var decode SegmentDecoder
+	if sd.Encoding != "json" {
+		if decode = getSegmentDecoder(sd.Encoding); decode == nil {
+			return nil, fmt.Errorf("trino: unsupported encoding %q", sd.Encoding)
+		}
+	}
+	workers := qr.stmt.conn.spoolingWorkers
+	if workers <= 0 {
+		workers = DefaultSpoolingWorkers
+	}
+	ctx, cancel := context.WithCancel(qr.ctx)
+	defer cancel()
+	var (
+		wg       sync.WaitGroup
+		sem      = make(chan struct{}, workers)
+		segments = make([][]byte, len(sd.Segments))
+		errOnce  sync.Once
+		err      error
+	)
+	fail := func(e error) {
+		errOnce.Do(func() {
+			err = e
+			cancel()
+		})
+	}
+	for i, seg := range sd.Segments {
+		switch seg.Type {
+		case "inline":
+			segments[i] = seg.Data
+		case "spooled":
+			wg.Add(1)
+			sem <- struct{}{}
+			go func(i int, seg segment) {
+				defer wg.Done()
+				defer func() { <-sem }()
+				data, err := qr.downloadSegment(ctx, seg)
+				if err != nil {
+					fail(err)
+					return
+				}
+				segments[i] = data
+			}(i, seg)
+		default:
+			fail(fmt.Errorf("trino: unsupported segment type %q", seg.Type))
+		}
+	}
+	wg.Wait()
+	if err != nil {
+		return nil, err
+	}
+	for i, seg := range sd.Segments {
+		if decode != nil && seg.Metadata.UncompressedSize > 0 {
+			data, err := decode(segments[i], seg.Metadata.UncompressedSize)
+			if err != nil {
+				return nil, fmt.Errorf("trino: cannot decode %s segment: %v", sd.Encoding, err)
+			}
+			segments[i] = data
+		}
+	}
+	return segments, nil
+}
+
+// downloadSegment downloads a spooled segment and acknowledges it. The
+// segment's URI points to the storage, or to a node of the cluster, and is
+// authorized by the headers sent with it rather than by the connection's.
+func (qr *driverRows) downloadSegment(ctx context.Context, seg segment) ([]byte, error) {
+	resp, err := qr.segmentRequest(ctx, seg.URI, seg.Headers)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, &ErrQueryFailed{
+			StatusCode: resp.StatusCode,
+			Reason:     fmt.Errorf("cannot download segment: http status is %s", resp.Status),
+		}
+	}
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, &ErrQueryFailed{Reason: err}
+	}
+	atomic.AddInt64(&qr.bytes, int64(len(data)))
+	if seg.AckURI != "" {
+		// best effort, the server deletes unacknowledged segments eventually
+		if resp, err := qr.segmentRequest(ctx, seg.AckURI, seg.Headers); err == nil {
+			resp.Body.Close()
+		}
+	}
+	return data, nil
+}
+
+func (qr *driverRows) segmentRequest(ctx context.Context, uri string, headers map[string][]string) (*http.Response, error) {
+	req, err := http.NewRequest("GET", uri, nil)
+	if err != nil {
+		return nil, fmt.Errorf("trino: %v", err)
+	}
+	for k, v := range headers {
+		req.Header[k] = v
+	}
+	resp, err := qr.stmt.conn.httpClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, &ErrQueryFailed{Reason: err}
+	}
+	return resp, nil
+}
+
+var errLZ4Corrupt = errors.New("corrupt lz4 block")
+
+// decodeLZ4Block decompresses an LZ4 block, the format of the segments
+// spooled with the json+lz4 encoding.
+func decodeLZ4Block(src []byte, uncompressedSize int) ([]byte, error) {
+	dst := make([]byte, 0, uncompressedSize)
+	// length reads the extra bytes of a literal or match length of 15
+	length := func(i, n int) (int, int, error) {
+		if n != 15 {
+			return i, n, nil
+		}
+		for {
+			if i >= len(src) {
+				return i, n, errLZ4Corrupt
+			}
+			b := src[i]
+			i++
+			n += int(b)
+			if b != 255 {
+				return i, n, nil
+			}
+		}
+	}
+	for i := 0; i < len(src); {
+		token := src[i]
+		i++
+		var literals, match int
+		var err error
+		if i, literals, err = length(i, int(token>>4)); err != nil {
+			return nil, err
+		}
+		if literals > len(src)-i || len(dst)+literals > uncompressedSize {
+			return nil, errLZ4Corrupt
+		}
+		dst = append(dst, src[i:i+literals]...)
+		i += literals
+		if i == len(src) {
+			// the last sequence has no match
+			break
+		}
+		if i+2 > len(src) {
+			return nil, errLZ4Corrupt
+		}
+		offset := int(src[i]) | int(src[i+1])<<8
+		i += 2
+		if i, match, err = length(i, int(token&15)); err != nil {
+			return nil, err
+		}
+		match += 4
+		if offset == 0 || offset > len(dst) || len(dst)+match > uncompressedSize {
+			return nil, errLZ4Corrupt
+		}
+		// the match may overlap the bytes it produces, copy one at a time
+		for start := len(dst) - offset; match > 0; match-- {
+			dst = append(dst, dst[start])
+			start++
+		}
+	}
+	if len(dst) != uncompressedSize {
+		return nil, errLZ4Corrupt
+	}
+	return dst, nil
+}
@@ -0,0 +1,262 @@
+package trino
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// lz4Literals compresses data as an LZ4 block of literals only, which is
+// valid if not smaller.
+func lz4Literals(data []byte) []byte {
+	n := len(data)
+	if n < 15 {
+		return append([]byte{byte(n << 4)}, data...)
+	}
+	b := []byte{0xf0}
+	for n -= 15; n >= 255; n -= 255 {
+		b = append(b, 255)
+	}
+	b = append(b, byte(n))
+	return append(b, data...)
+}
+
+func TestDecodeLZ4Block(t *testing.T) {
+	for _, tc := range []struct {
+		src  []byte
+		want string
+	}{
+		// "abc" then a match of 9 bytes at offset 3, overlapping its output
+		{[]byte{0x35, 'a', 'b', 'c', 3, 0, 0x00}, "abcabcabcabc"},
+		{lz4Literals([]byte("short")), "short"},
+		{lz4Literals(bytes.Repeat([]byte("x"), 300)), strings.Repeat("x", 300)},
+	} {
+		got, err := decodeLZ4Block(tc.src, len(tc.want))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != tc.want {
+			t.Errorf("got %q, want %q", got, tc.want)
+		}
+	}
+	for _, src := range [][]byte{
+		{0x35, 'a', 'b', 'c', 4, 0}, // offset before the start
+		{0x35, 'a', 'b', 'c', 3},    // truncated offset
+		{0x50, 'a', 'b'},            // truncated literals
+		{0x3f, 'a', 'b', 'c', 1, 0, 255, 255, 255, 255},
+	} {
+		if _, err := decodeLZ4Block(src, 12); err == nil {
+			t.Errorf("%v: no error", src)
+		}
+	}
+}
+
+// spoolingServer is a coordinator sending the results of every query as
+// one page of segments of 2 rows each: the first inline, the others
+// spooled.
+type spoolingServer struct {
+	*httptest.Server
+	segments int
+
+	mu        sync.Mutex
+	encodings string // requested by the client
+	acked     map[int]bool
+	active    int
+	maxActive int
+}
+
+func newSpoolingServer(segments int) *spoolingServer {
+	s := &spoolingServer{segments: segments, acked: make(map[int]bool)}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+func (s *spoolingServer) segmentData(n int) []byte {
+	data, _ := json.Marshal([][]int{{2 * n}, {2*n + 1}})
+	return data
+}
+
+// encoding returns the encoding picked by the server, the first it supports.
+func (s *spoolingServer) encoding() string {
+	for _, e := range strings.Split(s.encodings, ",") {
+		if e == "json" || e == "json+lz4" {
+			return e
+		}
+	}
+	return ""
+}
+
+func (s *spoolingServer) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	switch {
+	case r.Method == "POST" && r.URL.Path == "/v1/statement":
+		s.mu.Lock()
+		s.encodings = r.Header.Get("X-Trino-Query-Data-Encoding")
+		s.mu.Unlock()
+		json.NewEncoder(w).Encode(&stmtResponse{ID: "q1", NextURI: s.URL + "/v1/statement/executing/q1/0"})
+	case r.URL.Path == "/v1/statement/executing/q1/0":
+		s.mu.Lock()
+		encoding := s.encoding()
+		s.mu.Unlock()
+		qresp := queryResponse{
+			ID:      "q1",
+			Columns: []queryColumn{{Name: "n", Type: "bigint"}},
+			Stats:   QueryStats{State: "FINISHED"},
+		}
+		if encoding == "" {
+			// classic protocol
+			var rows [][]int
+			for i := 0; i < 2*s.segments; i++ {
+				rows = append(rows, []int{i})
+			}
+			qresp.Data, _ = json.Marshal(rows)
+		} else {
+			sd := spooledData{Encoding: encoding}
+			sd.Segments = append(sd.Segments, segment{Type: "inline", Data: s.segmentData(0)})
+			for i := 1; i < s.segments; i++ {
+				uri := s.URL + "/segments/" + strconv.Itoa(i)
+				sd.Segments = append(sd.Segments, segment{
+					Type:    "spooled",
+					URI:     uri,
+					AckURI:  uri + "/ack",
+					Headers: map[string][]string{"X-Segment-Token": {"secret"}},
+				})
+				if encoding == "json+lz4" {
+					sd.Segments[i].Metadata.UncompressedSize = len(s.segmentData(i))
+				}
+			}
+			qresp.Data, _ = json.Marshal(sd)
+		}
+		json.NewEncoder(w).Encode(&qresp)
+	case len(path) == 2 && path[0] == "segments":
+		if r.Header.Get("X-Segment-Token") != "secret" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		n, _ := strconv.Atoi(path[1])
+		s.mu.Lock()
+		s.active++
+		if s.active > s.maxActive {
+			s.maxActive = s.active
+		}
+		encoding := s.encoding()
+		s.mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+		data := s.segmentData(n)
+		if encoding == "json+lz4" {
+			data = lz4Literals(data)
+		}
+		w.Write(data)
+		s.mu.Lock()
+		s.active--
+		s.mu.Unlock()
+	case len(path) == 3 && path[0] == "segments" && path[2] == "ack":
+		n, _ := strconv.Atoi(path[1])
+		s.mu.Lock()
+		s.acked[n] = true
+		s.mu.Unlock()
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestSpooling(t *testing.T) {
+	for _, tc := range []struct {
+		encoding string
+		spooled  bool
+	}{
+		{"json", true},
+		{"json+lz4,json", true},
+		{"", false},
+	} {
+		t.Run(tc.encoding, func(t *testing.T) {
+			s := newSpoolingServer(6)
+			defer s.Close()
+
+			dsn := s.URL + "?spooling_workers=2"
+			if tc.encoding != "" {
+				dsn += "&encoding=" + url.QueryEscape(tc.encoding)
+			}
+			db, err := sql.Open("trino", dsn)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+
+			rows, err := db.Query("SELECT n")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer rows.Close()
+			want := 0
+			for rows.Next() {
+				var n int
+				if err := rows.Scan(&n); err != nil {
+					t.Fatal(err)
+				}
+				if n != want {
+					t.Fatalf("got row %d, want %d", n, want)
+				}
+				want++
+			}
+			if err := rows.Err(); err != nil {
+				t.Fatal(err)
+			}
+			if want != 12 {
+				t.Errorf("got %d rows, want 12", want)
+			}
+
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			if s.encodings != tc.encoding {
+				t.Errorf("requested encodings %q, want %q", s.encodings, tc.encoding)
+			}
+			if !tc.spooled {
+				return
+			}
+			if len(s.acked) != 5 {
+				t.Errorf("%d segments acknowledged, want 5", len(s.acked))
+			}
+			if s.maxActive > 2 {
+				t.Errorf("%d segments downloaded at the same time, want at most 2", s.maxActive)
+			}
+		})
+	}
+}
+
+func TestSpoolingFallback(t *testing.T) {
+	// servers that don't support spooling ignore the requested encodings
+	fc := newFakeCoordinator(3, 2)
+	defer fc.Close()
+
+	db, err := sql.Open("trino", fc.URL+"?encoding=json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	var n int
+	if err := db.QueryRow("SELECT n").Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSpoolingUnsupportedEncoding(t *testing.T) {
+	if _, err := newConn("http://localhost?encoding=json%2Bunknown"); err == nil {
+		t.Error("unsupported encoding accepted")
+	}
+	RegisterSegmentDecoder("json+test", func(data []byte, size int) ([]byte, error) {
+		return nil, fmt.Errorf("not implemented")
+	})
+	if _, err := newConn("http://localhost?encoding=json%2Btest,json"); err != nil {
+		t.Error(err)
+	}
+}
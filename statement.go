@@ -3,31 +3,28 @@ package trino
 import (
 	"context"
 	"database/sql/driver"
-	"encoding/json"
-	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"net/url"
 	"strings"
 )
 
-// driverStmt implements driver.Stmt & driver.StmtQueryContext
+// driverStmt implements driver.Stmt, driver.StmtQueryContext & driver.StmtExecContext
 type driverStmt struct {
-	conn  *Conn
-	query string
-	user  string
-
-	callback QueryCallBack
+	conn     *Conn
+	query    string
+	prepared string // the query prepared for the statement, e.g. for DESCRIBE OUTPUT
 }
 
 var (
 	_ driver.Stmt              = &driverStmt{}
 	_ driver.StmtQueryContext  = &driverStmt{}
+	_ driver.StmtExecContext   = &driverStmt{}
 	_ driver.NamedValueChecker = &driverStmt{}
 )
 
 func (st *driverStmt) Close() error {
-	st.callback = nil
 	return nil
 }
 
@@ -36,8 +33,7 @@ func (st *driverStmt) NumInput() int {
 }
 
 func (st *driverStmt) Exec(args []driver.Value) (driver.Result, error) {
-
-	return nil, ErrOperationNotSupported
+	return nil, driver.ErrSkip
 }
 
 func (st *driverStmt) Query(args []driver.Value) (driver.Rows, error) {
@@ -52,61 +48,29 @@ func (st *driverStmt) CheckNamedValue(arg *driver.NamedValue) error {
 }
 
 func (st *driverStmt) convertValue(v interface{}) (driver.Value, error) {
-	switch vr := (v).(type) {
+	switch v.(type) {
 	case QueryCallBack:
-		st.callback = vr
-		return nil, driver.ErrRemoveArgument
+		// kept as is and picked up by QueryContext, see queryOptions
+		return v, nil
 	}
 
 	return driver.DefaultParameterConverter.ConvertValue(v)
 }
 
 type stmtResponse struct {
-	ID      string    `json:"id"`
-	InfoURI string    `json:"infoUri"`
-	NextURI string    `json:"nextUri"`
-	Stats   stmtStats `json:"stats"`
-	Error   stmtError `json:"error"`
-}
-
-type stmtStats struct {
-	State              string    `json:"state"`
-	ProgressPercentage float32   `json:"progressPercentage"`
-	Scheduled          bool      `json:"scheduled"`
-	Nodes              int       `json:"nodes"`
-	TotalSplits        int       `json:"totalSplits"`
-	QueuesSplits       int       `json:"queuedSplits"`
-	RunningSplits      int       `json:"runningSplits"`
-	CompletedSplits    int       `json:"completedSplits"`
-	UserTimeMillis     int       `json:"userTimeMillis"`
-	CPUTimeMillis      int       `json:"cpuTimeMillis"`
-	WallTimeMillis     int       `json:"wallTimeMillis"`
-	ProcessedRows      int       `json:"processedRows"`
-	ProcessedBytes     int       `json:"processedBytes"`
-	RootStage          stmtStage `json:"rootStage"`
-}
-
-type stmtStage struct {
-	StageID         string      `json:"stageId"`
-	State           string      `json:"state"`
-	Done            bool        `json:"done"`
-	Nodes           int         `json:"nodes"`
-	TotalSplits     int         `json:"totalSplits"`
-	QueuedSplits    int         `json:"queuedSplits"`
-	RunningSplits   int         `json:"runningSplits"`
-	CompletedSplits int         `json:"completedSplits"`
-	UserTimeMillis  int         `json:"userTimeMillis"`
-	CPUTimeMillis   int         `json:"cpuTimeMillis"`
-	WallTimeMillis  int         `json:"wallTimeMillis"`
-	ProcessedRows   int         `json:"processedRows"`
-	ProcessedBytes  int         `json:"processedBytes"`
-	SubStages       []stmtStage `json:"subStages"`
+	ID       string     `json:"id"`
+	InfoURI  string     `json:"infoUri"`
+	NextURI  string     `json:"nextUri"`
+	Stats    QueryStats `json:"stats"`
+	Error    stmtError  `json:"error"`
+	Warnings []Warning  `json:"warnings"`
 }
 
 type stmtError struct {
 	Message       string               `json:"message"`
 	ErrorName     string               `json:"errorName"`
 	ErrorCode     int                  `json:"errorCode"`
+	ErrorType     string               `json:"errorType"`
 	ErrorLocation stmtErrorLocation    `json:"errorLocation"`
 	FailureInfo   stmtErrorFailureInfo `json:"failureInfo"`
 	// Other fields omitted
@@ -126,22 +90,67 @@ func (e stmtError) Error() string {
 	return e.FailureInfo.Type + ": " + e.Message
 }
 
+// ExecContext implements the driver.StmtExecContext interface. It runs the
+// query to completion and reports the update count returned by Trino.
+func (st *driverStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	rows, err := st.submit(ctx, args)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.nextURI != "" {
+		if err := rows.fetch(true); err != nil && err != io.EOF {
+			return nil, err
+		}
+	}
+	return &driverResult{
+		queryID:     rows.queryID,
+		stats:       rows.stats,
+		warnings:    rows.Warnings(),
+		updateCount: rows.updateCount,
+	}, nil
+}
+
+// QueryContext implements the driver.StmtQueryContext interface.
 func (st *driverStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	rows, err := st.submit(ctx, args)
+	if err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+func (st *driverStmt) submit(ctx context.Context, args []driver.NamedValue) (*driverRows, error) {
 	query := st.query
-	var hs http.Header
+	opts := queryOptionsFromContext(ctx)
+	hs := make(http.Header)
+	if st.prepared != "" {
+		hs.Set(_preparedStatementHeader, _preparedStatementName+"="+url.QueryEscape(st.prepared))
+	}
 
 	if len(args) > 0 {
-		hs = make(http.Header)
 		var ss []string
 		for _, arg := range args {
+			if cb, ok := arg.Value.(QueryCallBack); ok {
+				// backward-compatible form of WithProgress
+				opts.callback = cb
+				continue
+			}
 			switch arg.Name {
 			case UserHeader:
-				st.user = arg.Value.(string)
-				hs.Add(vhs[v]["user"], st.user)
-			case CallbackHeader:
-				// 正常情况下 sql.driverArgsConnLocked 中过滤掉了这个 case
-				err := st.CheckNamedValue(&arg)
-				if err != nil {
+				// backward-compatible form of WithUser
+				user, ok := arg.Value.(string)
+				if !ok {
+					return nil, fmt.Errorf("trino: %s must be a string, got %T", arg.Name, arg.Value)
+				}
+				opts.user = user
+			case ClientTagsHeader, ClientInfoHeader, TraceTokenHeader, RolesHeader, ExtraCredentialsHeader,
+				TimeZoneHeader, LanguageHeader, PathHeader, ResourceEstimatesHeader:
+				s, ok := arg.Value.(string)
+				if !ok {
+					return nil, fmt.Errorf("trino: %s must be a string, got %T", arg.Name, arg.Value)
+				}
+				if err := setClientHeader(hs, namedArgClientHeaders[arg.Name], s); err != nil {
 					return nil, err
 				}
 			default:
@@ -160,63 +169,163 @@ func (st *driverStmt) QueryContext(ctx context.Context, args []driver.NamedValue
 		}
 	}
 
-	req, err := st.conn.newRequest("POST", st.conn.baseURL+"/v1/statement", strings.NewReader(query), hs)
-	if err != nil {
+	if header := vhs[v]["queryDataEncoding"]; header != "" && len(st.conn.encodings) > 0 {
+		hs.Set(header, strings.Join(st.conn.encodings, ","))
+	}
+	if opts.user != "" {
+		hs.Set(vhs[v]["user"], opts.user)
+	}
+	if opts.catalog != "" {
+		hs.Set(vhs[v]["catalog"], opts.catalog)
+	}
+	if opts.schema != "" {
+		hs.Set(vhs[v]["schema"], opts.schema)
+	}
+	if len(opts.sessionProperties) > 0 {
+		props, err := parseKeyValueList(st.conn.httpHeaders.Get(vhs[v]["session"]))
+		if err != nil {
+			return nil, fmt.Errorf("trino: invalid session properties: %v", err)
+		}
+		for k, val := range opts.sessionProperties {
+			props[k] = val
+		}
+		hs.Set(vhs[v]["session"], formatKeyValueList(props))
+	}
+
+	tracker := st.conn.newQueryTracker(opts)
+	if !opts.detached {
+		tracker.metrics = st.conn.newQueryMetrics(opts.catalog)
+	}
+	if tracker.metrics != nil {
+		ctx = context.WithValue(ctx, queryMetricsKey{}, tracker.metrics)
+	}
+	ctx, span := startSpan(ctx, st.conn.tracer, SpanQuery)
+	if span != nil {
+		span.SetAttributes(Attribute{AttrStatement, st.query})
+		header := vhs[v]["traceToken"]
+		if id := traceID(span.TraceParent()); id != "" && hs.Get(header) == "" && st.conn.httpHeaders.Get(header) == "" {
+			hs.Set(header, id)
+		}
+	}
+
+	cancel := context.CancelFunc(func() {})
+	if opts.timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, opts.timeout)
+	}
+	fail := func(err error) (*driverRows, error) {
+		cancel()
+		tracker.failed(err)
+		if span != nil {
+			endSpan(span, err)
+		}
 		return nil, err
 	}
 
-	resp, err := st.conn.roundTrip(ctx, req)
+	resp, server, err := st.conn.submitQuery(ctx, query, hs)
 	if err != nil {
-		return nil, err
+		return fail(err)
 	}
-	defer resp.Body.Close()
-	var sr stmtResponse
-	d := json.NewDecoder(resp.Body)
-	d.UseNumber()
-	err = d.Decode(&sr)
+	sr, _, err := resp.queryResponse(nil, nil)
 	if err != nil {
-		return nil, fmt.Errorf("trino: %v", err)
+		return fail(err)
 	}
+	tracker.queryID = sr.ID
+	if span != nil {
+		span.SetAttributes(Attribute{AttrQueryID, sr.ID}, Attribute{AttrStatusCode, int64(resp.StatusCode)})
+	}
+	sr.NextURI = st.conn.rewriteURI(server, sr.NextURI)
+	sr.InfoURI = st.conn.rewriteURI(server, sr.InfoURI)
 	err = handleResponseError(resp.StatusCode, sr.Error)
 	if err != nil {
-		return nil, err
+		return fail(err)
 	}
+	warningErr := tracker.submitted(sr.ID, sr.InfoURI, sr.Stats, sr.Warnings)
 	rows := &driverRows{
-		ctx:     ctx,
-		stmt:    st,
-		nextURI: sr.NextURI,
+		ctx:      ctx,
+		cancel:   cancel,
+		stmt:     st,
+		server:   server,
+		span:     span,
+		user:     opts.user,
+		callback: opts.callback,
+		tracker:  tracker,
+		prefetch: st.conn.prefetchPages,
+		maxRows:  opts.maxRows,
+		nextURI:  sr.NextURI,
+		queryID:  sr.ID,
+		stats:    sr.Stats,
+	}
+
+	if opts.prefetchSet {
+		rows.prefetch = opts.prefetchPages
+	}
+	rows.canceller = newQueryCanceller(st.conn, server, rows.headers(), sr.ID, sr.NextURI)
+	rows.canceller.watch(ctx)
+	if sr.NextURI != "" {
+		st.conn.trackRows(rows)
 	}
 
 	// first callback
-	if st.callback != nil {
-		st.callback.OnUpdated(QueryInfo{
+	if rows.callback != nil {
+		rows.callback.OnUpdated(QueryInfo{
 			Id:         sr.ID,
 			QueryStats: sr.Stats,
-			Cancel: func() error {
-				req, err := st.conn.newRequest("DELETE", sr.NextURI, nil, hs)
-				if err != nil {
-					return err
-				}
-				return cancelQuery(req, st.conn.httpClient)
-			},
+			Warnings:   rows.Warnings(),
+			Cancel:     rows.canceller.cancel,
 		})
 	}
 
+	if warningErr != nil {
+		tracker.failed(warningErr)
+		rows.Close()
+		return nil, warningErr
+	}
+
+	if opts.detached {
+		return rows, nil
+	}
 	if err = rows.fetch(false); err != nil {
+		rows.Close()
 		return nil, err
 	}
 	return rows, nil
 }
 
-func cancelQuery(req *http.Request, client http.Client) error {
-	resp, err := client.Do(req)
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-	if resp.StatusCode != http.StatusOK {
-		return errors.New(fmt.Sprintf("cancel query error: http status is %s", resp.Status))
-	}
+// driverResult implements driver.Result
+type driverResult struct {
+	queryID     string
+	stats       QueryStats
+	warnings    []Warning
+	updateCount int64
+}
 
-	return nil
+var (
+	_ driver.Result      = &driverResult{}
+	_ QueryStatsProvider = &driverResult{}
+	_ WarningsProvider   = &driverResult{}
+)
+
+// LastInsertId implements the driver.Result interface.
+func (r *driverResult) LastInsertId() (int64, error) {
+	return 0, ErrOperationNotSupported
+}
+
+// RowsAffected implements the driver.Result interface.
+func (r *driverResult) RowsAffected() (int64, error) {
+	return r.updateCount, nil
+}
+
+// QueryID implements the QueryStatsProvider interface.
+func (r *driverResult) QueryID() string {
+	return r.queryID
+}
+
+// QueryStats implements the QueryStatsProvider interface.
+func (r *driverResult) QueryStats() QueryStats {
+	return r.stats
+}
+
+// Warnings implements the WarningsProvider interface.
+func (r *driverResult) Warnings() []Warning {
+	return r.warnings
 }
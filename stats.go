@@ -0,0 +1,77 @@
+package trino
+
+// QueryStats are the statistics of a query, as reported by Trino with every
+// response. Byte and row counts are int64 since they overflow int on 32-bit
+// platforms.
+type QueryStats struct {
+	State                string     `json:"state"`
+	Queued               bool       `json:"queued"`
+	Scheduled            bool       `json:"scheduled"`
+	ProgressPercentage   float64    `json:"progressPercentage"`
+	RunningPercentage    float64    `json:"runningPercentage"`
+	Nodes                int        `json:"nodes"`
+	TotalSplits          int        `json:"totalSplits"`
+	QueuedSplits         int        `json:"queuedSplits"`
+	RunningSplits        int        `json:"runningSplits"`
+	CompletedSplits      int        `json:"completedSplits"`
+	UserTimeMillis       int64      `json:"userTimeMillis"`
+	CPUTimeMillis        int64      `json:"cpuTimeMillis"`
+	WallTimeMillis       int64      `json:"wallTimeMillis"`
+	QueuedTimeMillis     int64      `json:"queuedTimeMillis"`
+	ElapsedTimeMillis    int64      `json:"elapsedTimeMillis"`
+	ProcessedRows        int64      `json:"processedRows"`
+	ProcessedBytes       int64      `json:"processedBytes"`
+	PhysicalInputBytes   int64      `json:"physicalInputBytes"`
+	PhysicalWrittenBytes int64      `json:"physicalWrittenBytes"`
+	PeakMemoryBytes      int64      `json:"peakMemoryBytes"`
+	SpilledBytes         int64      `json:"spilledBytes"`
+	RootStage            StageStats `json:"rootStage"`
+}
+
+// StageStats are the statistics of a stage of a query.
+type StageStats struct {
+	StageID            string       `json:"stageId"`
+	State              string       `json:"state"`
+	Done               bool         `json:"done"`
+	Nodes              int          `json:"nodes"`
+	TotalSplits        int          `json:"totalSplits"`
+	QueuedSplits       int          `json:"queuedSplits"`
+	RunningSplits      int          `json:"runningSplits"`
+	CompletedSplits    int          `json:"completedSplits"`
+	UserTimeMillis     int64        `json:"userTimeMillis"`
+	CPUTimeMillis      int64        `json:"cpuTimeMillis"`
+	WallTimeMillis     int64        `json:"wallTimeMillis"`
+	ProcessedRows      int64        `json:"processedRows"`
+	ProcessedBytes     int64        `json:"processedBytes"`
+	PhysicalInputBytes int64        `json:"physicalInputBytes"`
+	FailedTasks        int          `json:"failedTasks"`
+	CoordinatorOnly    bool         `json:"coordinatorOnly"`
+	SubStages          []StageStats `json:"subStages"`
+}
+
+// QueryStatsProvider is implemented by the driver.Rows and driver.Result
+// values of this driver. With database/sql they can be reached through
+// sql.Conn.Raw:
+//
+//	err := conn.Raw(func(driverConn interface{}) error {
+//		stmt, err := driverConn.(driver.ConnPrepareContext).PrepareContext(ctx, query)
+//		if err != nil {
+//			return err
+//		}
+//		rows, err := stmt.(driver.StmtQueryContext).QueryContext(ctx, nil)
+//		if err != nil {
+//			return err
+//		}
+//		defer rows.Close()
+//		// iterate with rows.Next, then:
+//		stats := rows.(trino.QueryStatsProvider).QueryStats()
+//		...
+//	})
+type QueryStatsProvider interface {
+	// QueryID returns the ID of the query.
+	QueryID() string
+
+	// QueryStats returns the latest statistics of the query. They are final
+	// once the results have been read to the end.
+	QueryStats() QueryStats
+}
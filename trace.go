@@ -0,0 +1,106 @@
+package trino
+
+import (
+	"context"
+	"io"
+	"strings"
+)
+
+// Tracer starts the spans tracing the queries of a Connector. The
+// trinootel package implements it on top of OpenTelemetry, so that the
+// driver itself doesn't depend on it.
+//
+// The driver starts a trino.query span for every query, from its
+// submission until its rows are closed, with trino.poll child spans for
+// the requests fetching its results and a trino.close child span when its
+// rows are closed. The traceparent of the span of every request is sent to
+// the coordinator, and the trace ID as the X-Trino-Trace-Token unless one
+// is set already, so that the Trino spans and logs of the query are part
+// of the same trace.
+type Tracer interface {
+	// Start starts a span as a child of the span in ctx, if any, and returns
+	// a context with the new span.
+	Start(ctx context.Context, name string) (context.Context, Span)
+}
+
+// Span is a span started by a Tracer.
+type Span interface {
+	SetAttributes(attrs ...Attribute)
+	RecordError(err error)
+	End()
+	// TraceParent returns the W3C traceparent identifying the span, e.g.
+	// 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01, or an empty
+	// string when the span has no valid span context.
+	TraceParent() string
+}
+
+// Attribute is an attribute of a Span. Values are strings, int64 or bool.
+type Attribute struct {
+	Key   string
+	Value interface{}
+}
+
+// Span names and attribute keys.
+const (
+	SpanQuery = "trino.query"
+	SpanPoll  = "trino.poll"
+	SpanClose = "trino.close"
+
+	AttrStatement      = "db.statement"
+	AttrQueryID        = "trino.query_id"
+	AttrState          = "trino.state"
+	AttrRows           = "trino.rows"
+	AttrBytes          = "trino.bytes"
+	AttrProcessedRows  = "trino.processed_rows"
+	AttrProcessedBytes = "trino.processed_bytes"
+	AttrRetries        = "trino.retries"
+	AttrStatusCode     = "http.status_code"
+)
+
+const _traceParentHeader = "traceparent"
+
+type spanKey struct{}
+
+// startSpan starts a span with tracer, unless it's nil.
+func startSpan(ctx context.Context, tracer Tracer, name string) (context.Context, Span) {
+	if tracer == nil {
+		return ctx, nil
+	}
+	ctx, span := tracer.Start(ctx, name)
+	return context.WithValue(ctx, spanKey{}, span), span
+}
+
+// spanFromContext returns the span started by the driver in ctx, if any.
+func spanFromContext(ctx context.Context) Span {
+	span, _ := ctx.Value(spanKey{}).(Span)
+	return span
+}
+
+// traceID returns the trace ID of a traceparent.
+func traceID(traceParent string) string {
+	parts := strings.Split(traceParent, "-")
+	if len(parts) < 4 {
+		return ""
+	}
+	return parts[1]
+}
+
+// endSpan records err, unless it's nil or io.EOF, and ends span.
+func endSpan(span Span, err error) {
+	if err != nil && err != io.EOF {
+		span.RecordError(err)
+	}
+	span.End()
+}
+
+// countingReader counts the bytes read from the body of a response.
+type countingReader struct {
+	io.ReadCloser
+	n int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.n += int64(n)
+	return n, err
+}
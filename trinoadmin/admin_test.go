@@ -0,0 +1,126 @@
+package trinoadmin
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func newServer(t *testing.T) (*httptest.Server, *[]string) {
+	var (
+		mu     sync.Mutex
+		killed []string
+	)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/info", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"nodeVersion":{"version":"439"},"environment":"test","coordinator":true,"uptime":"1.00h"}`))
+	})
+	mux.HandleFunc("/v1/node", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[{"uri":"http://worker-1:8080","recentRequests":10.5,"recentFailureRatio":0.1,"age":"1.00s"}]`))
+	})
+	mux.HandleFunc("/v1/node/failed", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[]`))
+	})
+	mux.HandleFunc("/v1/query", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("state") != "RUNNING" {
+			t.Errorf("unexpected state filter: %q", r.URL.RawQuery)
+		}
+		if user := r.Header.Get("X-Trino-User"); user != "admin" {
+			t.Errorf("got user %q, want admin", user)
+		}
+		w.Write([]byte(`[{"queryId":"q1","state":"RUNNING","query":"SELECT 1","session":{"user":"alice"},"queryStats":{"elapsedTime":"1.50s","totalDrivers":4}}]`))
+	})
+	mux.HandleFunc("/v1/query/q1", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"queryId":"q1","state":"FAILED","errorType":"USER_ERROR","errorCode":{"code":1,"name":"SYNTAX_ERROR","type":"USER_ERROR"},"failureInfo":{"type":"ParsingException","message":"oops"},"outputStage":{}}`))
+	})
+	mux.HandleFunc("/v1/query/q2/killed", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "PUT" {
+			t.Errorf("got method %s, want PUT", r.Method)
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		mu.Lock()
+		killed = append(killed, string(body))
+		mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("/v1/cluster", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"runningQueries":3,"activeWorkers":2,"reservedMemory":1024.0}`))
+	})
+	return httptest.NewServer(mux), &killed
+}
+
+func TestClient(t *testing.T) {
+	srv, killed := newServer(t)
+	defer srv.Close()
+	admin, err := New(strings.Replace(srv.URL, "http://", "http://admin@", 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer admin.Close()
+	ctx := context.Background()
+
+	info, err := admin.Info(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.NodeVersion.Version != "439" || !info.Coordinator {
+		t.Errorf("unexpected info: %+v", info)
+	}
+	nodes, err := admin.Nodes(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nodes) != 1 || nodes[0].URI != "http://worker-1:8080" || nodes[0].RecentRequests != 10.5 {
+		t.Errorf("unexpected nodes: %+v", nodes)
+	}
+	if failed, err := admin.FailedNodes(ctx); err != nil || len(failed) != 0 {
+		t.Errorf("unexpected failed nodes: %+v, %v", failed, err)
+	}
+	queries, err := admin.Queries(ctx, "RUNNING")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(queries) != 1 || queries[0].Session.User != "alice" || queries[0].QueryStats.TotalDrivers != 4 {
+		t.Errorf("unexpected queries: %+v", queries)
+	}
+	for _, get := range []func() (*QueryInfo, error){
+		func() (*QueryInfo, error) { return admin.Query(ctx, "q1") },
+		func() (*QueryInfo, error) { return admin.QueryFromInfoURI(ctx, srv.URL+"/ui/query.html?q1") },
+		// only the query ID is taken from the URI
+		func() (*QueryInfo, error) {
+			return admin.QueryFromInfoURI(ctx, "http://other.invalid/ui/query.html?q1")
+		},
+	} {
+		q, err := get()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if q.State != "FAILED" || q.ErrorCode.Name != "SYNTAX_ERROR" || q.FailureInfo.Message != "oops" || !strings.Contains(string(q.Raw), "outputStage") {
+			t.Errorf("unexpected query info: %+v", q)
+		}
+	}
+	if err := admin.KillQuery(ctx, "q2", "too slow"); err != nil {
+		t.Fatal(err)
+	}
+	if len(*killed) != 1 || (*killed)[0] != "too slow" {
+		t.Errorf("got kill messages %q", *killed)
+	}
+	stats, err := admin.ClusterStats(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.RunningQueries != 3 || stats.ActiveWorkers != 2 {
+		t.Errorf("unexpected cluster stats: %+v", stats)
+	}
+
+	_, err = admin.Query(ctx, "unknown")
+	var e *Error
+	if !errors.As(err, &e) || e.StatusCode != http.StatusNotFound {
+		t.Errorf("got %v, want a 404 error", err)
+	}
+}
@@ -0,0 +1,125 @@
+package trinoadmin
+
+import "encoding/json"
+
+// Durations and data sizes are reported by Trino as strings, e.g. 1.50s or
+// 12.3MB, and times in ISO 8601.
+
+// ServerInfo is the information of a coordinator.
+type ServerInfo struct {
+	NodeVersion struct {
+		Version string `json:"version"`
+	} `json:"nodeVersion"`
+	Environment string `json:"environment"`
+	Coordinator bool   `json:"coordinator"`
+	Starting    bool   `json:"starting"`
+	Uptime      string `json:"uptime"`
+}
+
+// Node is a node of the cluster, with the statistics of the requests the
+// coordinator sent to it.
+type Node struct {
+	URI                  string             `json:"uri"`
+	RecentRequests       float64            `json:"recentRequests"`
+	RecentFailures       float64            `json:"recentFailures"`
+	RecentSuccesses      float64            `json:"recentSuccesses"`
+	LastRequestTime      string             `json:"lastRequestTime"`
+	LastResponseTime     string             `json:"lastResponseTime"`
+	Age                  string             `json:"age"`
+	RecentFailureRatio   float64            `json:"recentFailureRatio"`
+	RecentFailuresByType map[string]float64 `json:"recentFailuresByType"`
+}
+
+// Session is the session a query runs in.
+type Session struct {
+	User    string `json:"user"`
+	Source  string `json:"source"`
+	Catalog string `json:"catalog"`
+	Schema  string `json:"schema"`
+}
+
+// ErrorCode is the error of a failed query.
+type ErrorCode struct {
+	Code int    `json:"code"`
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// BasicQueryStats are the statistics of a query listed by /v1/query.
+type BasicQueryStats struct {
+	CreateTime                string  `json:"createTime"`
+	EndTime                   string  `json:"endTime"`
+	QueuedTime                string  `json:"queuedTime"`
+	ElapsedTime               string  `json:"elapsedTime"`
+	ExecutionTime             string  `json:"executionTime"`
+	TotalCPUTime              string  `json:"totalCpuTime"`
+	TotalDrivers              int64   `json:"totalDrivers"`
+	QueuedDrivers             int64   `json:"queuedDrivers"`
+	RunningDrivers            int64   `json:"runningDrivers"`
+	CompletedDrivers          int64   `json:"completedDrivers"`
+	RawInputDataSize          string  `json:"rawInputDataSize"`
+	RawInputPositions         int64   `json:"rawInputPositions"`
+	PhysicalInputDataSize     string  `json:"physicalInputDataSize"`
+	CumulativeUserMemory      float64 `json:"cumulativeUserMemory"`
+	UserMemoryReservation     string  `json:"userMemoryReservation"`
+	TotalMemoryReservation    string  `json:"totalMemoryReservation"`
+	PeakUserMemoryReservation string  `json:"peakUserMemoryReservation"`
+	ProgressPercentage        float64 `json:"progressPercentage"`
+}
+
+// BasicQueryInfo is a query listed by /v1/query.
+type BasicQueryInfo struct {
+	QueryID    string          `json:"queryId"`
+	Session    Session         `json:"session"`
+	State      string          `json:"state"`
+	Scheduled  bool            `json:"scheduled"`
+	Self       string          `json:"self"`
+	Query      string          `json:"query"`
+	QueryType  string          `json:"queryType"`
+	UpdateType string          `json:"updateType"`
+	QueryStats BasicQueryStats `json:"queryStats"`
+	ErrorType  string          `json:"errorType"`
+	ErrorCode  *ErrorCode      `json:"errorCode"`
+}
+
+// FailureInfo describes the failure of a query.
+type FailureInfo struct {
+	Type    string       `json:"type"`
+	Message string       `json:"message"`
+	Cause   *FailureInfo `json:"cause"`
+}
+
+// QueryInfo is the full information of a query, from /v1/query/{id}. Only
+// the main fields are decoded, Raw holds the whole document.
+type QueryInfo struct {
+	QueryID     string          `json:"queryId"`
+	Session     Session         `json:"session"`
+	State       string          `json:"state"`
+	Scheduled   bool            `json:"scheduled"`
+	Self        string          `json:"self"`
+	Query       string          `json:"query"`
+	QueryType   string          `json:"queryType"`
+	UpdateType  string          `json:"updateType"`
+	QueryStats  BasicQueryStats `json:"queryStats"`
+	ErrorType   string          `json:"errorType"`
+	ErrorCode   *ErrorCode      `json:"errorCode"`
+	FailureInfo *FailureInfo    `json:"failureInfo"`
+	FinalInfo   bool            `json:"finalQueryInfo"`
+
+	Raw json.RawMessage `json:"-"`
+}
+
+// ClusterStats are the statistics of the cluster.
+type ClusterStats struct {
+	RunningQueries           int64   `json:"runningQueries"`
+	BlockedQueries           int64   `json:"blockedQueries"`
+	QueuedQueries            int64   `json:"queuedQueries"`
+	ActiveCoordinators       int64   `json:"activeCoordinators"`
+	ActiveWorkers            int64   `json:"activeWorkers"`
+	RunningDrivers           int64   `json:"runningDrivers"`
+	TotalAvailableProcessors int64   `json:"totalAvailableProcessors"`
+	ReservedMemory           float64 `json:"reservedMemory"`
+	TotalInputRows           int64   `json:"totalInputRows"`
+	TotalInputBytes          int64   `json:"totalInputBytes"`
+	TotalCPUTimeSecs         int64   `json:"totalCpuTimeSecs"`
+}
@@ -0,0 +1,85 @@
+// Package trinootel traces the queries of the Trino driver with
+// OpenTelemetry:
+//
+//	connector, err := trino.NewConnector(dsn)
+//	if err != nil {
+//		...
+//	}
+//	connector.Tracer = trinootel.NewTracer(otel.Tracer("reporting"))
+//	db := sql.OpenDB(connector)
+//
+// The spans are client spans, and the driver sends their W3C traceparent
+// with every request so that the spans of the query in Trino belong to the
+// same trace.
+package trinootel
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/CryBecase/trino"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Tracer is a trino.Tracer starting OpenTelemetry spans.
+type Tracer struct {
+	tracer trace.Tracer
+}
+
+var _ trino.Tracer = &Tracer{}
+
+// NewTracer returns a tracer starting the spans with tracer.
+func NewTracer(tracer trace.Tracer) *Tracer {
+	return &Tracer{tracer: tracer}
+}
+
+// Start implements the trino.Tracer interface.
+func (t *Tracer) Start(ctx context.Context, name string) (context.Context, trino.Span) {
+	ctx, s := t.tracer.Start(ctx, name, trace.WithSpanKind(trace.SpanKindClient))
+	return ctx, span{s}
+}
+
+// span adapts a trace.Span to the trino.Span interface.
+type span struct {
+	span trace.Span
+}
+
+func (s span) SetAttributes(attrs ...trino.Attribute) {
+	kvs := make([]attribute.KeyValue, len(attrs))
+	for i, a := range attrs {
+		switch v := a.Value.(type) {
+		case string:
+			kvs[i] = attribute.String(a.Key, v)
+		case int64:
+			kvs[i] = attribute.Int64(a.Key, v)
+		case int:
+			kvs[i] = attribute.Int(a.Key, v)
+		case bool:
+			kvs[i] = attribute.Bool(a.Key, v)
+		default:
+			kvs[i] = attribute.String(a.Key, fmt.Sprint(v))
+		}
+	}
+	s.span.SetAttributes(kvs...)
+}
+
+func (s span) RecordError(err error) {
+	s.span.RecordError(err)
+	s.span.SetStatus(codes.Error, err.Error())
+}
+
+func (s span) End() {
+	s.span.End()
+}
+
+// TraceParent returns the traceparent injected by the W3C trace context
+// propagator, which is empty unless the span context is valid.
+func (s span) TraceParent() string {
+	carrier := propagation.HeaderCarrier(http.Header{})
+	propagation.TraceContext{}.Inject(trace.ContextWithSpan(context.Background(), s.span), carrier)
+	return carrier.Get("traceparent")
+}
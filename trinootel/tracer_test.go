@@ -0,0 +1,147 @@
+package trinootel
+
+import (
+	"context"
+	"database/sql"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/CryBecase/trino"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// newServer returns a coordinator answering SELECT n with two rows over
+// two pages, and failing any other statement, and the traceparent headers
+// of the requests it received.
+func newServer(t *testing.T) (*httptest.Server, func() []string) {
+	var (
+		mu           sync.Mutex
+		traceParents []string
+	)
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		traceParents = append(traceParents, r.Header.Get("traceparent"))
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.Method == "POST" && r.URL.Path == "/v1/statement":
+			body, _ := ioutil.ReadAll(r.Body)
+			if string(body) != "SELECT n" {
+				w.Write([]byte(`{"id":"q2","stats":{"state":"FAILED"},"error":{"message":"line 1:1: mismatched input","errorName":"SYNTAX_ERROR","errorType":"USER_ERROR"}}`))
+				return
+			}
+			w.Write([]byte(`{"id":"q1","nextUri":"` + srv.URL + `/v1/statement/executing/q1/1","stats":{"state":"RUNNING"}}`))
+		case r.Method == "GET" && r.URL.Path == "/v1/statement/executing/q1/1":
+			w.Write([]byte(`{"id":"q1","columns":[{"name":"n","type":"bigint","typeSignature":{"rawType":"bigint","arguments":[]}}],"data":[[1],[2]],"stats":{"state":"FINISHED"}}`))
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	return srv, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), traceParents...)
+	}
+}
+
+func openDB(t *testing.T, url string) (*sql.DB, *tracetest.SpanRecorder) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	connector, err := trino.NewConnector(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	connector.Tracer = NewTracer(provider.Tracer("trinootel_test"))
+	return sql.OpenDB(connector), recorder
+}
+
+func TestTracer(t *testing.T) {
+	srv, traceParents := newServer(t)
+	defer srv.Close()
+	db, recorder := openDB(t, srv.URL)
+	defer db.Close()
+
+	rows, err := db.Query("SELECT n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for rows.Next() {
+	}
+	if err := rows.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	spans := recorder.Ended()
+	names := make(map[string]sdktrace.ReadOnlySpan)
+	for _, s := range spans {
+		names[s.Name()] = s
+		if s.SpanKind() != trace.SpanKindClient {
+			t.Errorf("span %s has kind %v", s.Name(), s.SpanKind())
+		}
+	}
+	query, ok := names[trino.SpanQuery]
+	if !ok {
+		t.Fatalf("no %s span in %d spans", trino.SpanQuery, len(spans))
+	}
+	poll, ok := names[trino.SpanPoll]
+	if !ok {
+		t.Fatalf("no %s span", trino.SpanPoll)
+	}
+	if poll.Parent().SpanID() != query.SpanContext().SpanID() {
+		t.Error("the poll span is not a child of the query span")
+	}
+	attrs := make(map[attribute.Key]attribute.Value)
+	for _, kv := range query.Attributes() {
+		attrs[kv.Key] = kv.Value
+	}
+	for k, want := range map[string]attribute.Value{
+		trino.AttrStatement: attribute.StringValue("SELECT n"),
+		trino.AttrQueryID:   attribute.StringValue("q1"),
+		trino.AttrState:     attribute.StringValue("FINISHED"),
+		trino.AttrRows:      attribute.Int64Value(2),
+	} {
+		if got := attrs[attribute.Key(k)]; !reflect.DeepEqual(got, want) {
+			t.Errorf("attribute %s = %v, want %v", k, got.Emit(), want.Emit())
+		}
+	}
+
+	got := traceParents()
+	want := []string{
+		"00-" + query.SpanContext().TraceID().String() + "-" + query.SpanContext().SpanID().String() + "-01",
+		"00-" + poll.SpanContext().TraceID().String() + "-" + poll.SpanContext().SpanID().String() + "-01",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got traceparents %q, want %q", got, want)
+	}
+}
+
+func TestTracerError(t *testing.T) {
+	srv, _ := newServer(t)
+	defer srv.Close()
+	db, recorder := openDB(t, srv.URL)
+	defer db.Close()
+
+	if _, err := db.QueryContext(context.Background(), "SELEC n"); err == nil {
+		t.Fatal("query succeeded")
+	}
+	spans := recorder.Ended()
+	if len(spans) != 1 || spans[0].Name() != trino.SpanQuery {
+		t.Fatalf("got %d spans, want the query span", len(spans))
+	}
+	if status := spans[0].Status(); status.Code != codes.Error {
+		t.Errorf("got status %v, want an error", status)
+	}
+	if events := spans[0].Events(); len(events) != 1 || events[0].Name != "exception" {
+		t.Errorf("got events %v, want the error", events)
+	}
+}
@@ -0,0 +1,243 @@
+// Package trinoprom exports the metrics of the Trino driver to Prometheus:
+//
+//	collector := trinoprom.NewCollector()
+//	prometheus.MustRegister(collector)
+//	connector, err := trino.NewConnector(dsn)
+//	if err != nil {
+//		...
+//	}
+//	connector.Name = "reporting"
+//	connector.Metrics = collector
+//	db := sql.OpenDB(connector)
+//
+// All the metrics are labelled by connector, catalog and source. The
+// collector is also an http.Handler serving its own metrics only, for
+// programs that don't use a Prometheus registry.
+package trinoprom
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/CryBecase/trino"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	// DefaultDurationBuckets are the upper bounds, in seconds, of the
+	// buckets of the trino_client_query_duration_seconds histogram.
+	DefaultDurationBuckets = []float64{0.1, 0.5, 1, 2.5, 5, 10, 30, 60, 300, 900, 3600}
+
+	// DefaultQueuedBuckets are the upper bounds, in seconds, of the buckets
+	// of the trino_client_query_queued_seconds histogram.
+	DefaultQueuedBuckets = []float64{0.01, 0.1, 0.5, 1, 5, 10, 30, 60, 300}
+)
+
+var labelNames = []string{"connector", "catalog", "source"}
+
+func newDesc(name, help string, extra ...string) *prometheus.Desc {
+	return prometheus.NewDesc(name, help, append(labelNames[:len(labelNames):len(labelNames)], extra...), nil)
+}
+
+var (
+	startedDesc   = newDesc("trino_client_queries_started_total", "Queries submitted.")
+	succeededDesc = newDesc("trino_client_queries_succeeded_total", "Queries that completed successfully.")
+	failedDesc    = newDesc("trino_client_queries_failed_total", "Queries that failed, by error type.", "error_type")
+	cancelledDesc = newDesc("trino_client_queries_cancelled_total", "Queries cancelled by their context or by closing their rows early.")
+	inFlightDesc  = newDesc("trino_client_queries_in_flight", "Queries submitted and not yet completed, failed or cancelled.")
+	durationDesc  = newDesc("trino_client_query_duration_seconds", "Time from the submission of queries to their end.")
+	queuedDesc    = newDesc("trino_client_query_queued_seconds", "Time spent by the completed queries in the queue of the coordinator.")
+	requestsDesc  = newDesc("trino_client_http_requests_total", "Responses of the coordinator to the requests submitting queries or fetching their results, by status code.", "code")
+	retriesDesc   = newDesc("trino_client_http_retries_total", "Requests retried because the coordinator was unavailable.")
+	rowsDesc      = newDesc("trino_client_received_rows_total", "Rows of results received.")
+	bytesDesc     = newDesc("trino_client_received_bytes_total", "Bytes of results received.")
+)
+
+// Collector is a trino.Metrics that keeps the measurements of the queries
+// in memory, and a prometheus.Collector exporting them.
+type Collector struct {
+	durationBuckets []float64
+	queuedBuckets   []float64
+	handler         http.Handler
+
+	mu     sync.Mutex
+	series map[trino.MetricsLabels]*series
+}
+
+var (
+	_ trino.Metrics        = &Collector{}
+	_ prometheus.Collector = &Collector{}
+	_ http.Handler         = &Collector{}
+)
+
+// series holds the metrics of a set of labels.
+type series struct {
+	started, succeeded, cancelled uint64
+	failed                        map[string]uint64 // by error type
+	inFlight                      int64
+	requests                      map[int]uint64 // by status code
+	retries                       uint64
+	rows, bytes                   uint64
+	duration, queued              histogram
+}
+
+type histogram struct {
+	counts []uint64 // per bucket, not cumulative, the last one is +Inf
+	sum    float64
+	count  uint64
+}
+
+func (h *histogram) observe(buckets []float64, v float64) {
+	if h.counts == nil {
+		h.counts = make([]uint64, len(buckets)+1)
+	}
+	h.counts[sort.SearchFloat64s(buckets, v)]++
+	h.sum += v
+	h.count++
+}
+
+// metric returns the histogram as a constant metric.
+func (h *histogram) metric(desc *prometheus.Desc, buckets []float64, labels []string) prometheus.Metric {
+	cumulative := make(map[float64]uint64, len(buckets))
+	var n uint64
+	for i, le := range buckets {
+		if h.counts != nil {
+			n += h.counts[i]
+		}
+		cumulative[le] = n
+	}
+	return prometheus.MustNewConstHistogram(desc, h.count, h.sum, cumulative, labels...)
+}
+
+// NewCollector returns a collector using the default buckets.
+func NewCollector() *Collector {
+	c := &Collector{
+		durationBuckets: DefaultDurationBuckets,
+		queuedBuckets:   DefaultQueuedBuckets,
+		series:          make(map[trino.MetricsLabels]*series),
+	}
+	registry := prometheus.NewPedanticRegistry()
+	registry.MustRegister(c)
+	c.handler = promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+	return c
+}
+
+// get returns the series of labels, with c.mu held.
+func (c *Collector) get(labels trino.MetricsLabels) *series {
+	s, ok := c.series[labels]
+	if !ok {
+		s = &series{
+			failed:   make(map[string]uint64),
+			requests: make(map[int]uint64),
+		}
+		c.series[labels] = s
+	}
+	return s
+}
+
+// QueryStarted implements the trino.Metrics interface.
+func (c *Collector) QueryStarted(labels trino.MetricsLabels) {
+	c.mu.Lock()
+	s := c.get(labels)
+	s.started++
+	s.inFlight++
+	c.mu.Unlock()
+}
+
+// QueryCompleted implements the trino.Metrics interface.
+func (c *Collector) QueryCompleted(labels trino.MetricsLabels, duration, queued time.Duration) {
+	c.mu.Lock()
+	s := c.get(labels)
+	s.succeeded++
+	s.inFlight--
+	s.duration.observe(c.durationBuckets, duration.Seconds())
+	s.queued.observe(c.queuedBuckets, queued.Seconds())
+	c.mu.Unlock()
+}
+
+// QueryFailed implements the trino.Metrics interface.
+func (c *Collector) QueryFailed(labels trino.MetricsLabels, errorType string, duration time.Duration) {
+	c.mu.Lock()
+	s := c.get(labels)
+	s.failed[errorType]++
+	s.inFlight--
+	s.duration.observe(c.durationBuckets, duration.Seconds())
+	c.mu.Unlock()
+}
+
+// QueryCancelled implements the trino.Metrics interface.
+func (c *Collector) QueryCancelled(labels trino.MetricsLabels, duration time.Duration) {
+	c.mu.Lock()
+	s := c.get(labels)
+	s.cancelled++
+	s.inFlight--
+	s.duration.observe(c.durationBuckets, duration.Seconds())
+	c.mu.Unlock()
+}
+
+// HTTPResponse implements the trino.Metrics interface.
+func (c *Collector) HTTPResponse(labels trino.MetricsLabels, statusCode int, retried bool) {
+	c.mu.Lock()
+	s := c.get(labels)
+	s.requests[statusCode]++
+	if retried {
+		s.retries++
+	}
+	c.mu.Unlock()
+}
+
+// Received implements the trino.Metrics interface.
+func (c *Collector) Received(labels trino.MetricsLabels, rows, bytes int64) {
+	c.mu.Lock()
+	s := c.get(labels)
+	s.rows += uint64(rows)
+	s.bytes += uint64(bytes)
+	c.mu.Unlock()
+}
+
+// Describe implements the prometheus.Collector interface.
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	for _, d := range []*prometheus.Desc{
+		startedDesc, succeededDesc, failedDesc, cancelledDesc, inFlightDesc,
+		durationDesc, queuedDesc, requestsDesc, retriesDesc, rowsDesc, bytesDesc,
+	} {
+		ch <- d
+	}
+}
+
+// Collect implements the prometheus.Collector interface.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for l, s := range c.series {
+		labels := []string{l.Connector, l.Catalog, l.Source}
+		counter := func(desc *prometheus.Desc, v uint64, extra ...string) {
+			ch <- prometheus.MustNewConstMetric(desc, prometheus.CounterValue, float64(v), append(labels, extra...)...)
+		}
+		counter(startedDesc, s.started)
+		counter(succeededDesc, s.succeeded)
+		for errorType, n := range s.failed {
+			counter(failedDesc, n, errorType)
+		}
+		counter(cancelledDesc, s.cancelled)
+		ch <- prometheus.MustNewConstMetric(inFlightDesc, prometheus.GaugeValue, float64(s.inFlight), labels...)
+		ch <- s.duration.metric(durationDesc, c.durationBuckets, labels)
+		ch <- s.queued.metric(queuedDesc, c.queuedBuckets, labels)
+		for code, n := range s.requests {
+			counter(requestsDesc, n, strconv.Itoa(code))
+		}
+		counter(retriesDesc, s.retries)
+		counter(rowsDesc, s.rows)
+		counter(bytesDesc, s.bytes)
+	}
+}
+
+// ServeHTTP serves the metrics of the collector, and only them, in the
+// Prometheus exposition format.
+func (c *Collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c.handler.ServeHTTP(w, r)
+}
@@ -0,0 +1,95 @@
+package trinoprom
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/CryBecase/trino"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestCollector(t *testing.T) {
+	c := NewCollector()
+	hive := trino.MetricsLabels{Connector: "main", Catalog: "hive", Source: `a "quoted" source`}
+	c.QueryStarted(hive)
+	c.HTTPResponse(hive, 503, true)
+	c.HTTPResponse(hive, 200, false)
+	c.Received(hive, 10, 1024)
+	c.QueryCompleted(hive, 2*time.Second, 100*time.Millisecond)
+	c.QueryStarted(hive)
+	c.QueryFailed(hive, "USER_ERROR", time.Second)
+	c.QueryStarted(hive)
+	c.QueryStarted(hive)
+	c.QueryCancelled(hive, time.Second)
+
+	w := httptest.NewRecorder()
+	c.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("got content type %q", ct)
+	}
+	got := w.Body.String()
+	labels := `catalog="hive",connector="main",source="a \"quoted\" source"`
+	for _, want := range []string{
+		"# TYPE trino_client_queries_started_total counter\n",
+		"trino_client_queries_started_total{" + labels + "} 4\n",
+		"trino_client_queries_succeeded_total{" + labels + "} 1\n",
+		`trino_client_queries_failed_total{catalog="hive",connector="main",error_type="USER_ERROR",source="a \"quoted\" source"} 1` + "\n",
+		"trino_client_queries_cancelled_total{" + labels + "} 1\n",
+		"trino_client_queries_in_flight{" + labels + "} 1\n",
+		"# TYPE trino_client_query_duration_seconds histogram\n",
+		"trino_client_query_duration_seconds_bucket{" + labels + `,le="1"} 2` + "\n",
+		"trino_client_query_duration_seconds_bucket{" + labels + `,le="2.5"} 3` + "\n",
+		"trino_client_query_duration_seconds_bucket{" + labels + `,le="+Inf"} 3` + "\n",
+		"trino_client_query_duration_seconds_sum{" + labels + "} 4\n",
+		"trino_client_query_duration_seconds_count{" + labels + "} 3\n",
+		"trino_client_query_queued_seconds_bucket{" + labels + `,le="0.1"} 1` + "\n",
+		"trino_client_query_queued_seconds_count{" + labels + "} 1\n",
+		`trino_client_http_requests_total{catalog="hive",code="200",connector="main",source="a \"quoted\" source"} 1` + "\n",
+		`trino_client_http_requests_total{catalog="hive",code="503",connector="main",source="a \"quoted\" source"} 1` + "\n",
+		"trino_client_http_retries_total{" + labels + "} 1\n",
+		"trino_client_received_rows_total{" + labels + "} 10\n",
+		"trino_client_received_bytes_total{" + labels + "} 1024\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("missing %q in:\n%s", want, got)
+		}
+	}
+}
+
+func TestCollectorRegistered(t *testing.T) {
+	c := NewCollector()
+	registry := prometheus.NewPedanticRegistry()
+	if err := registry.Register(c); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := testutil.GatherAndCount(registry); err != nil || n != 0 {
+		t.Fatalf("got %d metrics and error %v before any query", n, err)
+	}
+	main := trino.MetricsLabels{Connector: "main", Catalog: "hive", Source: "etl"}
+	other := trino.MetricsLabels{Connector: "other", Catalog: "tpch"}
+	c.QueryStarted(main)
+	c.QueryCompleted(main, 3*time.Second, 0)
+	c.QueryStarted(other)
+	c.QueryFailed(other, "INTERNAL_ERROR", time.Second)
+	c.QueryStarted(other)
+
+	want := `
+# HELP trino_client_queries_in_flight Queries submitted and not yet completed, failed or cancelled.
+# TYPE trino_client_queries_in_flight gauge
+trino_client_queries_in_flight{catalog="hive",connector="main",source="etl"} 0
+trino_client_queries_in_flight{catalog="tpch",connector="other",source=""} 1
+# HELP trino_client_queries_failed_total Queries that failed, by error type.
+# TYPE trino_client_queries_failed_total counter
+trino_client_queries_failed_total{catalog="tpch",connector="other",error_type="INTERNAL_ERROR",source=""} 1
+`
+	if err := testutil.GatherAndCompare(registry, strings.NewReader(want),
+		"trino_client_queries_in_flight", "trino_client_queries_failed_total"); err != nil {
+		t.Error(err)
+	}
+	if problems, err := testutil.GatherAndLint(registry); err != nil || len(problems) != 0 {
+		t.Errorf("got lint problems %v and error %v", problems, err)
+	}
+}
@@ -14,33 +14,281 @@ import (
 
 type typeConverter struct {
 	typeName   string
-	parsedType []string // e.g. array, array, varchar, for [][]string
+	parsedType []string      // e.g. array, array, varchar, for [][]string
+	decode     columnDecoder // nil for types decoded with decodeGeneric
 }
 
 func newTypeConverter(typeName string) *typeConverter {
+	parsedType := parseType(typeName)
 	return &typeConverter{
 		typeName:   typeName,
-		parsedType: parseType(typeName),
+		parsedType: parsedType,
+		decode:     newColumnDecoder(parsedType),
 	}
 }
 
-// parses presto types, e.g. array(varchar(10)) to "array", "varchar"
-// TODO: Use queryColumn.TypeSignature instead.
+// parseType returns the name of a type followed by the names of its first
+// type arguments, e.g. array, array, varchar for array(array(varchar(10))).
 func parseType(name string) []string {
-	parts := strings.Split(name, "(")
-	if len(parts) == 1 {
-		return parts
+	t, err := ParseType(name)
+	if err != nil {
+		return []string{name}
 	}
-	last := len(parts) - 1
-	parts[last] = strings.TrimRight(parts[last], ")")
-	if len(parts[last]) > 0 {
-		if _, err := strconv.Atoi(parts[last]); err == nil {
-			parts = parts[:last]
-		}
+	parts := []string{t.Name}
+	for len(t.Arguments) > 0 {
+		t = t.Arguments[0]
+		parts = append(parts, t.Name)
 	}
 	return parts
 }
 
+// Type is a parsed Trino type, as named in the columns of results and in
+// metadata, e.g. the name decimal with the literals 10 and 2 for
+// decimal(10,2), or the name map with the arguments varchar and bigint for
+// map(varchar, bigint).
+type Type struct {
+	Name      string   // e.g. varchar, row or timestamp with time zone
+	Literals  []int64  // e.g. the length of varchar(10) or the precision of timestamp(3)
+	Arguments []Type   // the types of the elements of an array, the keys and values of a map or the fields of a row
+	Fields    []string // the names of the fields of a row, empty for anonymous fields
+}
+
+// String returns the type as named by Trino.
+func (t Type) String() string {
+	if len(t.Literals) == 0 && len(t.Arguments) == 0 {
+		return t.Name
+	}
+	name, suffix := t.Name, ""
+	if i := strings.Index(name, " with"); i > 0 {
+		// timestamp(3) with time zone
+		name, suffix = name[:i], name[i:]
+	}
+	var args []string
+	for _, l := range t.Literals {
+		args = append(args, strconv.FormatInt(l, 10))
+	}
+	for i, arg := range t.Arguments {
+		s := arg.String()
+		if i < len(t.Fields) && t.Fields[i] != "" {
+			field := t.Fields[i]
+			if !isPlainIdentifier(field) {
+				field = QuoteIdentifier(field)
+			}
+			s = field + " " + s
+		}
+		args = append(args, s)
+	}
+	return name + "(" + strings.Join(args, ", ") + ")" + suffix
+}
+
+// ParseType parses a type named by Trino, e.g. varchar(10),
+// timestamp(3) with time zone or row(id bigint, "first name" varchar).
+func ParseType(name string) (Type, error) {
+	p := typeParser{s: name}
+	t, err := p.parseType()
+	if err == nil {
+		p.skipSpace()
+		if p.pos < len(p.s) {
+			err = p.errorf("unexpected %q", p.s[p.pos:])
+		}
+	}
+	if err != nil {
+		return Type{}, err
+	}
+	return t, nil
+}
+
+// parseTypeOrName parses a type, keeping only the name of a type that
+// could not be parsed.
+func parseTypeOrName(name string) Type {
+	t, err := ParseType(name)
+	if err != nil {
+		return Type{Name: name}
+	}
+	return t
+}
+
+// multiWordTypes are the types with a name made of several words, which
+// are told apart from the named fields of rows.
+var multiWordTypes = map[string]bool{
+	"double precision":         true,
+	"time with time zone":      true,
+	"timestamp with time zone": true,
+	"interval year to month":   true,
+	"interval day to second":   true,
+}
+
+type typeParser struct {
+	s   string
+	pos int
+}
+
+func (p *typeParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("trino: invalid type %q: %s", p.s, fmt.Sprintf(format, args...))
+}
+
+func (p *typeParser) skipSpace() {
+	for p.pos < len(p.s) && p.s[p.pos] == ' ' {
+		p.pos++
+	}
+}
+
+func (p *typeParser) peek() byte {
+	p.skipSpace()
+	if p.pos == len(p.s) {
+		return 0
+	}
+	return p.s[p.pos]
+}
+
+// words reads the words up to the next parenthesis, comma or quote.
+func (p *typeParser) words() []string {
+	var words []string
+	for {
+		p.skipSpace()
+		start := p.pos
+		for p.pos < len(p.s) && isIdentifierChar(rune(p.s[p.pos])) {
+			p.pos++
+		}
+		if p.pos == start {
+			return words
+		}
+		words = append(words, p.s[start:p.pos])
+	}
+}
+
+func (p *typeParser) quoted() (string, error) {
+	var b strings.Builder
+	for p.pos++; p.pos < len(p.s); p.pos++ {
+		c := p.s[p.pos]
+		if c == '"' {
+			if p.pos+1 < len(p.s) && p.s[p.pos+1] == '"' {
+				p.pos++
+			} else {
+				p.pos++
+				return b.String(), nil
+			}
+		}
+		b.WriteByte(c)
+	}
+	return "", p.errorf("unterminated quoted identifier")
+}
+
+func (p *typeParser) parseType() (Type, error) {
+	words := p.words()
+	if len(words) == 0 {
+		return Type{}, p.errorf("missing type name at offset %d", p.pos)
+	}
+	return p.parseArguments(words)
+}
+
+// parseArguments parses the arguments of the type named by words, if any.
+func (p *typeParser) parseArguments(words []string) (Type, error) {
+	t := Type{Name: strings.Join(words, " ")}
+	if p.peek() != '(' {
+		return t, nil
+	}
+	p.pos++
+	for {
+		if err := p.parseArgument(&t); err != nil {
+			return Type{}, err
+		}
+		switch p.peek() {
+		case ',':
+			p.pos++
+			continue
+		case ')':
+			p.pos++
+		default:
+			return Type{}, p.errorf("missing ) at offset %d", p.pos)
+		}
+		break
+	}
+	if suffix := p.words(); len(suffix) > 0 {
+		// timestamp(3) with time zone
+		t.Name += " " + strings.Join(suffix, " ")
+	}
+	return t, nil
+}
+
+func (p *typeParser) parseArgument(t *Type) error {
+	c := p.peek()
+	if c >= '0' && c <= '9' {
+		start := p.pos
+		for p.pos < len(p.s) && p.s[p.pos] >= '0' && p.s[p.pos] <= '9' {
+			p.pos++
+		}
+		n, err := strconv.ParseInt(p.s[start:p.pos], 10, 64)
+		if err != nil {
+			return p.errorf("%v", err)
+		}
+		t.Literals = append(t.Literals, n)
+		return nil
+	}
+	if t.Name != "row" {
+		arg, err := p.parseType()
+		if err != nil {
+			return err
+		}
+		t.Arguments = append(t.Arguments, arg)
+		return nil
+	}
+
+	var field string
+	var words []string
+	if c == '"' {
+		var err error
+		if field, err = p.quoted(); err != nil {
+			return err
+		}
+		words = p.words()
+	} else {
+		words = p.words()
+		if len(words) > 1 && !multiWordTypes[strings.ToLower(strings.Join(words, " "))] {
+			field, words = words[0], words[1:]
+		}
+	}
+	if len(words) == 0 {
+		return p.errorf("missing type name at offset %d", p.pos)
+	}
+	arg, err := p.parseArguments(words)
+	if err != nil {
+		return err
+	}
+	if field != "" && t.Fields == nil {
+		t.Fields = make([]string, len(t.Arguments))
+	}
+	if t.Fields != nil {
+		t.Fields = append(t.Fields, field)
+	}
+	t.Arguments = append(t.Arguments, arg)
+	return nil
+}
+
+func isIdentifierChar(r rune) bool {
+	return r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9'
+}
+
+// QuoteIdentifier quotes name to be used as an identifier in a query, e.g.
+// the name of a catalog, a table or a column, whatever the characters in it.
+func QuoteIdentifier(name string) string {
+	return `"` + strings.Replace(name, `"`, `""`, -1) + `"`
+}
+
+// isPlainIdentifier reports whether name can be used as an identifier
+// without quotes.
+func isPlainIdentifier(name string) bool {
+	if name == "" || name[0] >= '0' && name[0] <= '9' {
+		return false
+	}
+	for _, r := range name {
+		if !isIdentifierChar(r) || r >= 'A' && r <= 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
 // ConvertValue implements the driver.ValueConverter interface.
 func (c *typeConverter) ConvertValue(v interface{}) (driver.Value, error) {
 	switch c.parsedType[0] {
@@ -524,6 +772,10 @@ func scanNullTime(v interface{}) (NullTime, error) {
 	if !ok {
 		return NullTime{}, fmt.Errorf("cannot convert %v (%T) to time string", v, v)
 	}
+	return parseNullTimeString(vv)
+}
+
+func parseNullTimeString(vv string) (NullTime, error) {
 	vparts := strings.Split(vv, " ")
 	if len(vparts) > 1 && !unicode.IsDigit(rune(vparts[len(vparts)-1][0])) {
 		return parseNullTimeWithLocation(vv)
@@ -0,0 +1,22 @@
+package trino
+
+// Warning is a warning raised by Trino while planning or running a query,
+// such as the use of a deprecated function.
+type Warning struct {
+	Code    WarningCode `json:"warningCode"`
+	Message string      `json:"message"`
+}
+
+// WarningCode identifies the kind of a Warning.
+type WarningCode struct {
+	Code int    `json:"code"`
+	Name string `json:"name"`
+}
+
+// WarningsProvider is implemented by the driver.Rows and driver.Result
+// values of this driver, see QueryStatsProvider for how to reach them.
+type WarningsProvider interface {
+	// Warnings returns the warnings raised by the query so far, across all
+	// pages of results.
+	Warnings() []Warning
+}